@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"slices"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/jasonlvhit/gocron"
@@ -20,11 +24,44 @@ var f pkg.Flags
 
 var version = "dev"
 
-var filePaths []string
+// exitShutdownTimeout is the exit code when the running scan did not finish within --shutdown-secs
+const exitShutdownTimeout = 2
+
+// shutdownCtx is done on SIGINT or SIGTERM, no new cycle is started after that
+var shutdownCtx = context.Background()
+
+// scanCtx is cancelled --shutdown-secs after shutdownCtx, aborting the running scan and notifications
+var scanCtx = context.Background()
+
+// rules to watch, the flags alone are one unnamed rule when no --config is given
+var rules []pkg.Flags
+
+// file paths by rule name
+var filePaths = make(map[string][]string)
 var filePathsMutex sync.Mutex
 
+var followers []*pkg.Follower
+var followersMutex sync.Mutex
+
+// fileCache is the state of one rule and file, its mutex serializes scans of the file
+type fileCache struct {
+	sync.Mutex
+	cache *cache.Cache
+}
+
+// caches by pkg.StateKey, so rules watching the same file keep separate state
 var cacheMutex sync.Mutex
-var caches = make(map[string]*cache.Cache)
+var caches = make(map[string]*fileCache)
+
+// cycleMutex is read locked by every running cycle, shutdown write locks it to wait for them
+var cycleMutex sync.RWMutex
+
+// scanJob is one file of a rule to scan in a cycle
+type scanJob struct {
+	rule     pkg.Flags
+	filePath string
+	result   *pkg.ScanResult
+}
 
 //go:embed geoip.csv
 var geoipCSV string
@@ -83,38 +120,185 @@ func main() {
 		return
 	}
 
-	syncFilePaths()
+	rules, err = pkg.LoadRules(f)
+	if err != nil {
+		slog.Error("Failed to load rules", "error", err.Error())
+		return
+	}
+	for _, rule := range rules {
+		if rule.Absent && f.Every == 0 {
+			slog.Warn("--absent needs --every to notify on missing heartbeats", "rule", rule.Name)
+		}
+	}
 
-	for _, filePath := range filePaths {
-		watch(filePath)
+	handleShutdown()
+	cronWatch()
+
+	if f.Follow {
+		startFollowers()
 	}
-	if f.Every > 0 {
+	if f.Every > 0 || f.Follow {
+		handleReload()
 		startCron()
 	}
+	shutdown()
 }
 
-func syncCaches() {
+// handleShutdown stops new cycles on SIGINT or SIGTERM, the running scan gets
+// --shutdown-secs to finish before scanCtx is cancelled
+func handleShutdown() {
+	var stop, cancelScan context.CancelFunc
+	shutdownCtx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	scanCtx, cancelScan = context.WithCancel(context.Background())
+	context.AfterFunc(shutdownCtx, func() {
+		// a second signal exits at once instead of waiting for the running scans
+		stop()
+		time.AfterFunc(time.Duration(f.ShutdownSecs)*time.Second, cancelScan)
+	})
+}
+
+// shutdown waits for the running cycles, they hold cycleMutex until their
+// scans and notifications are done or scanCtx is cancelled
+func shutdown() {
+	if shutdownCtx.Err() != nil {
+		slog.Info("Shutting down, finishing the running scans", "timeout (secs)", f.ShutdownSecs)
+	}
+	stopFollowers()
+
+	cycleMutex.Lock()
+	defer cycleMutex.Unlock()
+
+	if scanCtx.Err() != nil {
+		slog.Warn("Shutdown deadline exceeded, the running scan was cut short", "timeout (secs)", f.ShutdownSecs)
+		os.Exit(exitShutdownTimeout)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// handleReload re-reads the rules on SIGHUP, an invalid config keeps the running rules
+func handleReload() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			reload()
+		}
+	}()
+}
+
+func reload() {
+	slog.Info("Reloading rules", "config", f.Config)
+	newRules, err := pkg.LoadRules(f)
+	if err != nil {
+		slog.Error("Invalid config, keeping the running rules", "error", err.Error())
+		return
+	}
+
+	// a running cycle would save the state of a changed rule back after it is reset
+	cycleMutex.Lock()
+	filePathsMutex.Lock()
+	added, removed, changed := pkg.DiffRules(rules, newRules)
+	slog.Info("Rules reloaded", "added", added, "removed", removed, "changed", changed)
+	var closing []closingAlert
+	for _, rule := range rules {
+		if slices.Contains(removed, rule.Name) || slices.Contains(changed, rule.Name) {
+			next := slices.IndexFunc(newRules, func(r pkg.Flags) bool { return r.Name == rule.Name })
+			var newRule *pkg.Flags
+			if next >= 0 {
+				newRule = &newRules[next]
+			}
+			closing = append(closing, resetState(rule, newRule, filePaths[rule.Name])...)
+		}
+	}
+	rules = newRules
+	for _, name := range removed {
+		delete(filePaths, name)
+	}
+	filePathsMutex.Unlock()
+	cycleMutex.Unlock()
+
+	for _, c := range closing {
+		slog.Info("Resolving the alert of a reset rule", "rule", c.rule.Name, "filePath", c.filePath)
+		pkg.NotifyClosed(scanCtx, c.filePath, c.alert, c.rule, version, httpClient)
+	}
+
+	// patterns are compiled by pkg.NewWatcher on every scan, the sync adds and removes files,
+	// caches are keyed by rule name and file so state of untouched rules is kept
+	syncFilePaths()
+
+	if f.Follow {
+		stopFollowers()
+		startFollowers()
+	}
+}
+
+// closingAlert is a firing alert of a reset rule whose incident nothing else would resolve
+type closingAlert struct {
+	rule     pkg.Flags
+	filePath string
+	alert    *pkg.Alert
+}
+
+// resetState deletes the caches and saved state of a removed or changed rule, so its
+// streaks and baselines start over instead of carrying over to the new rule.
+// A firing alert is kept when newRule sends it to the same incident, else it is returned to be resolved
+func resetState(rule pkg.Flags, newRule *pkg.Flags, rulePaths []string) []closingAlert {
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
-	for filePath := range caches {
-		found := false
-		for _, f := range filePaths {
-			if f == filePath {
-				found = true
-				break
+
+	var closing []closingAlert
+	store := pkg.NewStateStore(rule)
+	for _, filePath := range rulePaths {
+		key := pkg.StateKey(rule, filePath)
+		var alert *pkg.Alert
+		if fc, ok := caches[key]; ok {
+			alert = pkg.StoredAlert(rule, filePath, fc.cache)
+		}
+		slog.Info("Deleting cache obj", "key", key)
+		delete(caches, key)
+		if store != nil {
+			if err := store.Delete(key); err != nil {
+				slog.Warn("Error deleting state", "key", key, "error", err.Error())
 			}
 		}
-		if !found {
-			slog.Info("Deleting cache obj", "filePath", filePath)
-			delete(caches, filePath)
+
+		switch {
+		case alert == nil || alert.State != pkg.AlertFiring:
+			// no incident is open
+		case newRule != nil && pkg.SameIncident(rule, *newRule, filePath, alert.Severity):
+			fc := &fileCache{cache: cache.New(cache.NoExpiration, cache.NoExpiration)}
+			pkg.KeepAlert(filePath, alert, fc.cache)
+			caches[key] = fc
+		case !rule.Digest:
+			// with --digest the incident is the one of the digest, it resolves with its other files
+			closing = append(closing, closingAlert{rule: rule, filePath: filePath, alert: alert})
+		}
+	}
+	return closing
+}
+
+func syncCaches() {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	keys := make(map[string]struct{})
+	for _, rule := range rules {
+		for _, filePath := range filePaths[rule.Name] {
+			keys[pkg.StateKey(rule, filePath)] = struct{}{}
+		}
+	}
+	for key := range caches {
+		if _, found := keys[key]; !found {
+			slog.Info("Deleting cache obj", "key", key)
+			delete(caches, key)
 		}
 	}
-	for _, filePath := range filePaths {
-		if _, ok := caches[filePath]; ok {
+	for key := range keys {
+		if _, ok := caches[key]; ok {
 			continue
 		}
-		slog.Info("Creating cache obj", "filePath", filePath)
-		caches[filePath] = cache.New(cache.NoExpiration, cache.NoExpiration)
+		slog.Info("Creating cache obj", "key", key)
+		caches[key] = &fileCache{cache: cache.New(cache.NoExpiration, cache.NoExpiration)}
 	}
 }
 
@@ -124,49 +308,173 @@ func startCron() {
 		return
 	}
 
-	if err := gocron.Every(f.Every).Second().Do(cronWatch); err != nil {
-		slog.Error("Error scheduling cron", "error", err.Error())
-		return
+	// In follow mode --every is optional, it keeps streaks moving for quiet files
+	if f.Every > 0 {
+		if err := gocron.Every(f.Every).Second().Do(cronWatch); err != nil {
+			slog.Error("Error scheduling cron", "error", err.Error())
+			return
+		}
+	}
+	stopped := gocron.Start()
+	<-shutdownCtx.Done()
+	stopped <- true
+}
+
+func startFollowers() {
+	followersMutex.Lock()
+	defer followersMutex.Unlock()
+
+	filePathsMutex.Lock()
+	defer filePathsMutex.Unlock()
+
+	for _, rule := range rules {
+		follower, err := pkg.NewFollower(rule.FilePath, time.Duration(f.FollowWindowMS)*time.Millisecond)
+		if err != nil {
+			slog.Error("Error following files", "error", err.Error(), "rule", rule.Name)
+			continue
+		}
+		followers = append(followers, follower)
+		go follower.Run(func(changed []string) {
+			followWatch(rule, changed)
+		})
 	}
-	<-gocron.Start()
+}
+
+func stopFollowers() {
+	followersMutex.Lock()
+	defer followersMutex.Unlock()
+
+	for _, follower := range followers {
+		if err := follower.Close(); err != nil {
+			slog.Warn("Error closing follower", "error", err.Error())
+		}
+	}
+	followers = nil
+}
+
+// followWatch scans only the files of the rule that changed, new files are picked up by the sync
+func followWatch(rule pkg.Flags, changed []string) {
+	runCycle(func(r pkg.Flags, filePath string) bool {
+		return r.Name == rule.Name && slices.Contains(changed, filePath)
+	})
 }
 
 func cronWatch() {
+	runCycle(func(pkg.Flags, string) bool {
+		return true
+	})
+}
+
+// runCycle syncs the file paths and watches the ones that are due
+func runCycle(due func(rule pkg.Flags, filePath string) bool) {
+	cycleMutex.RLock()
+	defer cycleMutex.RUnlock()
+
+	if shutdownCtx.Err() != nil {
+		return
+	}
 	syncFilePaths()
+	watchAll(scanJobs(due))
+}
 
+func scanJobs(due func(rule pkg.Flags, filePath string) bool) []*scanJob {
 	filePathsMutex.Lock()
 	defer filePathsMutex.Unlock()
 
+	var jobs []*scanJob
+	for _, rule := range rules {
+		for _, filePath := range filePaths[rule.Name] {
+			if due(rule, filePath) {
+				jobs = append(jobs, &scanJob{rule: rule, filePath: filePath})
+			}
+		}
+	}
+	return jobs
+}
+
+// watchAll scans the files on --workers goroutines, then reports them in
+// order so logs and notifications stay deterministic
+func watchAll(jobs []*scanJob) {
+	pkg.ForEachBounded(len(jobs), f.Workers, func(i int) {
+		jobs[i].result = scan(scanCtx, jobs[i].rule, jobs[i].filePath)
+	})
+
+	var digests pkg.Digests
+	for _, job := range jobs {
+		if job.result == nil {
+			continue
+		}
+		if f.Digest && !job.result.IsFirstScan() && digests.Add(job.rule, job.result) {
+			logResult(job.rule, job.result)
+			slog.Info("Alert added to the digest", "rule", job.rule.Name, "alert", job.result.Alert)
+		} else {
+			reportResult(scanCtx, job.rule, job.result)
+		}
+		if _, err := pkg.ExecShell(job.rule.PostCommand); err != nil {
+			slog.Error("Error running post command", "error", err.Error())
+		}
+	}
+	for _, digest := range digests {
+		trackDigest(digest)
+		pkg.NotifyDigest(scanCtx, digest, version, httpClient)
+	}
+}
+
+// trackDigest notes the alert of every file the digest covers, with --follow a cycle
+// only scans the files that changed and the others may still be firing
+func trackDigest(digest *pkg.Digest) {
+	filePathsMutex.Lock()
+	defer filePathsMutex.Unlock()
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 
-	for _, filePath := range filePaths {
-		watch(filePath)
+	for _, rule := range rules {
+		if !digest.Covers(rule) {
+			continue
+		}
+		for _, filePath := range filePaths[rule.Name] {
+			if fc, ok := caches[pkg.StateKey(rule, filePath)]; ok {
+				digest.Track(pkg.StoredAlert(rule, filePath, fc.cache))
+			}
+		}
 	}
 }
 
 func syncFilePaths() {
 	slog.Info("Syncing files")
 
-	fpCrawled, err := pkg.FilesByPattern(f.FilePath, f.FileRecentSecs)
+	filePathsMutex.Lock()
+	defer filePathsMutex.Unlock()
+
+	fileCount := 0
+	for _, rule := range rules {
+		syncRuleFilePaths(rule)
+		fileCount += len(filePaths[rule.Name])
+	}
+
+	syncCaches()
+	slog.Info("Files synced", "fileCount", fileCount, "cacheCount", len(caches))
+}
+
+func syncRuleFilePaths(rule pkg.Flags) {
+	// a heartbeat file going quiet is what an --absent rule looks for
+	recentSecs := rule.FileRecentSecs
+	if rule.Absent {
+		recentSecs = 0
+	}
+	fpCrawled, err := pkg.FilesByPattern(rule.FilePath, recentSecs)
 	if err != nil {
-		slog.Error("Error finding files", "error", err.Error())
+		slog.Error("Error finding files", "error", err.Error(), "rule", rule.Name)
 		return
 	}
 	if len(fpCrawled) == 0 {
-		slog.Warn("No files found", "filePath", f.FilePath)
+		slog.Warn("No files found", "filePath", rule.FilePath, "rule", rule.Name)
 		slog.Warn("Keep watching for new files")
 		return
 	}
 
 	// Filter and cap file paths
-	filePathsMutex.Lock()
-	defer filePathsMutex.Unlock()
-
-	filePaths = filterTextFiles(pkg.Capped(f.FilePathsCap, fpCrawled))
-
-	syncCaches()
-	slog.Info("Files synced", "fileCount", len(filePaths), "cacheCount", len(caches))
+	filePaths[rule.Name] = filterTextFiles(pkg.Capped(rule.FilePathsCap, fpCrawled))
 }
 
 // filterTextFiles filters file paths to include only text files.
@@ -184,35 +492,54 @@ func validate() {
 	if f.Test {
 		return
 	}
-	if f.FilePath == "" {
-		slog.Error("file-path is required")
+	if f.FilePath == "" && f.Config == "" {
+		slog.Error("file-path or config is required")
 		return
 	}
 }
 
-func watch(filePath string) {
-	watcher, err := pkg.NewWatcher(filePath, f, caches[filePath], geoIPDB)
+func scan(ctx context.Context, rule pkg.Flags, filePath string) *pkg.ScanResult {
+	cacheMutex.Lock()
+	fc, ok := caches[pkg.StateKey(rule, filePath)]
+	cacheMutex.Unlock()
+	if !ok {
+		return nil
+	}
+
+	// cron and follow may both be due for the same file
+	fc.Lock()
+	defer fc.Unlock()
+
+	watcher, err := pkg.NewWatcher(filePath, rule, fc.cache, geoIPDB)
 
 	if err != nil {
 		slog.Error("Error creating watcher", "error", err.Error(), "filePath", filePath)
-		return
+		return nil
 	}
 	defer watcher.Close()
 
-	slog.Info("Scanning file", "filePath", filePath)
+	slog.Info("Scanning file", "filePath", filePath, "rule", rule.Name)
 
-	result, err := watcher.Scan()
+	if f.ScanTimeoutSecs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(f.ScanTimeoutSecs)*time.Second)
+		defer cancel()
+	}
+
+	result, err := watcher.Scan(ctx)
 	if err != nil {
 		slog.Warn("Error scanning file", "error", err.Error(), "filePath", filePath)
-		return
+		return nil
 	}
-	reportResult(result)
-	if _, err := pkg.ExecShell(f.PostCommand); err != nil {
-		slog.Error("Error running post command", "error", err.Error())
+	// under the file lock, so cron and follow never move the same alert twice
+	if err := watcher.UpdateAlert(result, rule, time.Now()); err != nil {
+		slog.Warn("Error saving alert state", "error", err.Error(), "filePath", filePath)
 	}
+	return result
 }
 
-func reportResult(result *pkg.ScanResult) {
+// logResult logs what a scan found
+func logResult(rule pkg.Flags, result *pkg.ScanResult) {
 	slog.Info("File info", "filePath", result.FilePath, "size", result.FileInfo.Size(), "modTime", result.FileInfo.ModTime())
 	slog.Info("Lines read", "count", result.LinesRead)
 	slog.Info("Scanning complete", "filePath", result.FilePath)
@@ -220,23 +547,58 @@ func reportResult(result *pkg.ScanResult) {
 	slog.Info("Preview line", "line", pkg.Truncate(result.PreviewLine, pkg.TruncateMax))
 
 	slog.Info("Last line", "date", result.LastDate, "line", pkg.Truncate(result.LastLine, pkg.TruncateMax))
-	slog.Info("Error count", "percent", fmt.Sprintf("%d (%.2f)", result.ErrorCount, result.ErrorPercent)+"%")
-	slog.Info("History", "max streak", f.Streak, "current streaks", result.Streak, "symbols", pkg.StreakSymbols(result.Streak, f.Streak, f.Min))
+	slog.Info("Error count", "percent", fmt.Sprintf("%d (%.2f)", result.ErrorCount, result.ErrorPercent)+"%", "rate", fmt.Sprintf("%.2f/sec", result.ErrorRate))
+	slog.Info("History", "max streak", rule.Streak, "current streaks", result.Streak, "symbols", pkg.StreakSymbols(result.Streak, rule.Streak, rule.Min))
+	if result.Access != nil {
+		requests, latency := result.Access.Summary()
+		slog.Info("Requests", "counts", requests, "time", latency, "exceeded", result.Exceeded)
+	}
+	for name, counts := range result.CaptureCounts {
+		slog.Info("Captured", "group", name, "counts", pkg.TopCounts(counts, rule.Top))
+	}
+	if result.Anomaly != nil {
+		slog.Info("Anomaly", "baseline", result.Anomaly.String())
+	}
+	if result.StaleCount > 0 {
+		slog.Info("Stale lines", "count", result.StaleCount, "max age secs", rule.MaxAgeSecs)
+	}
+	if len(result.MatchCounts) > 0 {
+		slog.Info("Match counts", "counts", pkg.OrderedAsc(result.MatchCounts))
+	}
 	slog.Info("Countries", "counts", fmt.Sprintf("%d, %v", len(result.CountryCounts), result.CountryCounts))
 	slog.Info("Scan", "count", result.ScanCount)
+}
+
+func reportResult(ctx context.Context, rule pkg.Flags, result *pkg.ScanResult) {
+	logResult(rule, result)
 
 	if result.IsFirstScan() {
 		slog.Info("First scan, skipping notification")
 		return
 	}
 
-	if !pkg.NonStreakZero(result.Streak, f.Streak, f.Min) {
-		slog.Info("Streak not met", "streak", f.Streak, "streaks", result.Streak)
-		return
-	}
-
-	if pkg.IsRecentlyModified(result.FileInfo, f.Every) {
-		pkg.Notify(result, f, version, httpClient)
+	switch result.Alert {
+	case pkg.AlertTrigger:
+		if rule.Absent {
+			slog.Warn("Missing heartbeat", "rule", rule.Name, "reason", result.AlertReason)
+			pkg.NotifyMissingHeartbeat(ctx, result, rule, result.AlertReason, version, httpClient)
+			return
+		}
+		pkg.Notify(ctx, result, rule, version, httpClient)
+	case pkg.AlertSuppressed:
+		slog.Info("Notification suppressed", "rule", rule.Name, "cooldown (secs)", rule.CooldownSecs, "renotify (secs)", rule.RenotifySecs)
+	case pkg.AlertAcknowledge:
+		slog.Info("Alert clearing, acknowledging", "rule", rule.Name, "streaks", result.Streak)
+		pkg.NotifyAcknowledged(ctx, result, rule, version, httpClient)
+	case pkg.AlertResolve:
+		slog.Info("Alert resolved", "rule", rule.Name, "clear scans", rule.ResolveAfter)
+		pkg.NotifyResolved(ctx, result, rule, version, httpClient)
+	case pkg.AlertNone:
+		if rule.Absent {
+			slog.Info("Heartbeat seen", "rule", rule.Name, "streaks", result.Streak)
+			return
+		}
+		slog.Info("Streak not met", "streak", rule.Streak, "streaks", result.Streak)
 	}
 }
 
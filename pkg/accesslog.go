@@ -0,0 +1,245 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Access log formats understood by --format, any other value containing $ is
+// read as an nginx log_format string
+const (
+	FormatCombined  = "combined"
+	FormatNginxMain = "nginx-main"
+)
+
+var accessLogFormats = map[string]string{
+	FormatCombined:  `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+	FormatNginxMain: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`,
+}
+
+// accessLogFields renames nginx variables to the field names used in --where and --fields
+var accessLogFields = map[string]string{
+	"time_local":      "time",
+	"body_bytes_sent": "bytes",
+	"bytes_sent":      "bytes",
+	"http_referer":    "referrer",
+	"http_user_agent": "user_agent",
+}
+
+var logFormatVariable = regexp.MustCompile(`\$([a-z_][a-z0-9_]*)`)
+
+var statusClassRegex = regexp.MustCompile(`^[1-5]xx$`)
+
+// accessLogParser reads lines written by an nginx log_format or Apache LogFormat
+// $request is also split into method, path and protocol
+type accessLogParser struct {
+	regex  *regexp.Regexp
+	fields []string
+}
+
+func newAccessLogParser(logFormat string) (*accessLogParser, error) {
+	locations := logFormatVariable.FindAllStringSubmatchIndex(logFormat, -1)
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("log format %q has no $variables", logFormat)
+	}
+
+	p := &accessLogParser{}
+	var sb strings.Builder
+	sb.WriteByte('^')
+	last := 0
+	for i, loc := range locations {
+		sb.WriteString(regexp.QuoteMeta(logFormat[last:loc[0]]))
+		last = loc[1]
+
+		name := logFormat[loc[2]:loc[3]]
+		if field, ok := accessLogFields[name]; ok {
+			name = field
+		}
+		p.fields = append(p.fields, name)
+
+		// a variable runs until the literal text after it
+		switch {
+		case loc[1] == len(logFormat):
+			sb.WriteString(`(.*)`)
+		case i+1 < len(locations) && locations[i+1][0] == loc[1]:
+			return nil, fmt.Errorf("log format %q has no separator after $%s", logFormat, name)
+		default:
+			sb.WriteString(`([^` + regexp.QuoteMeta(logFormat[loc[1]:loc[1]+1]) + `]*)`)
+		}
+	}
+	sb.WriteString(regexp.QuoteMeta(logFormat[last:]))
+
+	var err error
+	if p.regex, err = regexp.Compile(sb.String()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *accessLogParser) Parse(line []byte) (Record, bool) {
+	m := p.regex.FindSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	record := make(Record, len(p.fields)+3)
+	for i, field := range p.fields {
+		record[field] = string(m[i+1])
+	}
+	if request, ok := record["request"]; ok {
+		parts := strings.SplitN(request, " ", 3)
+		if len(parts) == 3 {
+			record["method"], record["path"], record["protocol"] = parts[0], parts[1], parts[2]
+		}
+	}
+	return record, true
+}
+
+// latencyReservoir bounds the request times kept per scan, percentiles of larger scans are estimated from a uniform sample
+const latencyReservoir = 10000
+
+// AccessStats summarises the requests of one scan, lines without a status are not requests
+type AccessStats struct {
+	Requests      int
+	StatusClasses map[string]int // 2xx, 4xx, 5xx...
+	Latencies     []float64      // sample of at most latencyReservoir request times in seconds, sorted by Scan
+	LatencyCount  int            // request times seen, sampled or not
+	MaxLatency    float64
+}
+
+func NewAccessStats() *AccessStats {
+	return &AccessStats{StatusClasses: make(map[string]int)}
+}
+
+// latencyFields are tried in order, nginx and apache use request_time, LTSV uses reqtime
+var latencyFields = []string{"request_time", "reqtime"}
+
+func (a *AccessStats) add(record Record) {
+	status := record["status"]
+	if len(status) != 3 {
+		return
+	}
+	a.Requests++
+	a.StatusClasses[status[:1]+"xx"]++
+	for _, field := range latencyFields {
+		if latency, err := strconv.ParseFloat(record[field], 64); err == nil {
+			a.addLatency(latency)
+			break
+		}
+	}
+}
+
+// addLatency keeps every request time with the same chance once the reservoir is full
+func (a *AccessStats) addLatency(latency float64) {
+	a.LatencyCount++
+	a.MaxLatency = max(a.MaxLatency, latency)
+	if len(a.Latencies) < latencyReservoir {
+		a.Latencies = append(a.Latencies, latency)
+		return
+	}
+	if i := rand.IntN(a.LatencyCount); i < latencyReservoir {
+		a.Latencies[i] = latency
+	}
+}
+
+// StatusPercent returns the percentage of requests in the status class, e.g. 5xx
+func (a *AccessStats) StatusPercent(class string) float64 {
+	if a.Requests == 0 {
+		return 0
+	}
+	return float64(a.StatusClasses[class]) * 100 / float64(a.Requests)
+}
+
+// Percentile returns the nearest rank percentile of the request times, p is 0-100
+func (a *AccessStats) Percentile(p float64) float64 {
+	if len(a.Latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(a.Latencies)))) - 1
+	rank = max(0, min(rank, len(a.Latencies)-1))
+	return a.Latencies[rank]
+}
+
+// AccessThresholds decide whether a scan of an access log counts towards the streak
+type AccessThresholds struct {
+	StatusClass   string
+	StatusPercent float64
+	Percentile    float64
+	LatencySecs   float64
+}
+
+// ParseAccessThresholds reads --status-percent (e.g. 5xx:2) and --latency (e.g. p95:1.5)
+// nil is returned when neither is given
+func ParseAccessThresholds(statusPercent, latency string) (*AccessThresholds, error) {
+	if statusPercent == "" && latency == "" {
+		return nil, nil
+	}
+	t := &AccessThresholds{}
+	if statusPercent != "" {
+		class, percent, ok := strings.Cut(statusPercent, ":")
+		if !ok || !statusClassRegex.MatchString(class) {
+			return nil, fmt.Errorf("status-percent %q is not like 5xx:2", statusPercent)
+		}
+		value, err := strconv.ParseFloat(percent, 64)
+		if err != nil {
+			return nil, fmt.Errorf("status-percent %q: %w", statusPercent, err)
+		}
+		t.StatusClass, t.StatusPercent = class, value
+	}
+	if latency != "" {
+		percentile, secs, ok := strings.Cut(latency, ":")
+		p, err := strconv.ParseFloat(strings.TrimPrefix(percentile, "p"), 64)
+		if !ok || err != nil || !strings.HasPrefix(percentile, "p") || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("latency %q is not like p95:1.5", latency)
+		}
+		value, err := strconv.ParseFloat(secs, 64)
+		if err != nil {
+			return nil, fmt.Errorf("latency %q: %w", latency, err)
+		}
+		t.Percentile, t.LatencySecs = p, value
+	}
+	return t, nil
+}
+
+// Exceeded lists the thresholds the stats are over, empty when the scan is healthy
+func (t *AccessThresholds) Exceeded(a *AccessStats) []string {
+	var exceeded []string
+	if a == nil {
+		return exceeded
+	}
+	if t.StatusClass != "" {
+		if percent := a.StatusPercent(t.StatusClass); percent > t.StatusPercent {
+			exceeded = append(exceeded, fmt.Sprintf("%s %.2f%% > %g%%", t.StatusClass, percent, t.StatusPercent))
+		}
+	}
+	if t.Percentile > 0 {
+		if latency := a.Percentile(t.Percentile); latency > t.LatencySecs {
+			exceeded = append(exceeded, fmt.Sprintf("p%g %.3fs > %gs", t.Percentile, latency, t.LatencySecs))
+		}
+	}
+	return exceeded
+}
+
+// Summary renders the status classes and request times for notifications
+func (a *AccessStats) Summary() (requests, latency string) {
+	classes := make([]string, 0, len(a.StatusClasses))
+	for class := range a.StatusClasses {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	parts := []string{NumberToK(a.Requests)}
+	for _, class := range classes {
+		parts = append(parts, fmt.Sprintf("%s: %d (%.2f%%)", class, a.StatusClasses[class], a.StatusPercent(class)))
+	}
+	requests = strings.Join(parts, ", ")
+
+	if len(a.Latencies) > 0 {
+		latency = fmt.Sprintf("p50 %.3fs, p95 %.3fs, p99 %.3fs, max %.3fs",
+			a.Percentile(50), a.Percentile(95), a.Percentile(99), a.MaxLatency)
+	}
+	return requests, latency
+}
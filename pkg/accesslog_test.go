@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		line     string
+		expected Record
+	}{
+		{
+			name:   "combined",
+			format: FormatCombined,
+			line:   `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			expected: Record{
+				"remote_addr": "127.0.0.1",
+				"remote_user": "frank",
+				"time":        "10/Oct/2000:13:55:36 -0700",
+				"request":     "GET /apache_pb.gif HTTP/1.0",
+				"method":      "GET",
+				"path":        "/apache_pb.gif",
+				"protocol":    "HTTP/1.0",
+				"status":      "200",
+				"bytes":       "2326",
+				"referrer":    "http://www.example.com/start.html",
+				"user_agent":  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+			},
+		},
+		{
+			name:   "nginx main",
+			format: FormatNginxMain,
+			line:   `10.0.0.1 - - [01/Jan/2024:10:00:00 +0900] "POST /api/users HTTP/1.1" 503 0 "-" "curl/8.0" "192.168.0.1"`,
+			expected: Record{
+				"remote_addr":          "10.0.0.1",
+				"remote_user":          "-",
+				"time":                 "01/Jan/2024:10:00:00 +0900",
+				"request":              "POST /api/users HTTP/1.1",
+				"method":               "POST",
+				"path":                 "/api/users",
+				"protocol":             "HTTP/1.1",
+				"status":               "503",
+				"bytes":                "0",
+				"referrer":             "-",
+				"user_agent":           "curl/8.0",
+				"http_x_forwarded_for": "192.168.0.1",
+			},
+		},
+		{
+			name:   "log_format string",
+			format: `$remote_addr [$time_local] "$request" $status $request_time`,
+			line:   `10.0.0.1 [01/Jan/2024:10:00:00 +0900] "GET / HTTP/1.1" 200 0.125`,
+			expected: Record{
+				"remote_addr":  "10.0.0.1",
+				"time":         "01/Jan/2024:10:00:00 +0900",
+				"request":      "GET / HTTP/1.1",
+				"method":       "GET",
+				"path":         "/",
+				"protocol":     "HTTP/1.1",
+				"status":       "200",
+				"request_time": "0.125",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewLineParser(tt.format)
+			assert.NoError(t, err)
+			record, ok := parser.Parse([]byte(tt.line))
+			assert.True(t, ok)
+			assert.Equal(t, tt.expected, record)
+
+			_, ok = parser.Parse([]byte("not an access log line"))
+			assert.False(t, ok)
+		})
+	}
+
+	_, err := NewLineParser("$remote_addr$status")
+	assert.Error(t, err)
+}
+
+func TestAccessStats(t *testing.T) {
+	stats := NewAccessStats()
+	for i, status := range []string{"200", "200", "200", "503", "404", "-"} {
+		stats.add(Record{"status": status, "request_time": []string{"0.1", "0.2", "0.3", "2.0", "0.5", "9"}[i]})
+	}
+	assert.Equal(t, 5, stats.Requests)
+	assert.Equal(t, map[string]int{"2xx": 3, "4xx": 1, "5xx": 1}, stats.StatusClasses)
+	assert.InDelta(t, 20.0, stats.StatusPercent("5xx"), 0.001)
+	assert.Equal(t, 5, stats.LatencyCount)
+
+	stats.Latencies = []float64{0.1, 0.2, 0.3, 0.5, 2.0}
+	assert.Equal(t, 0.3, stats.Percentile(50))
+	assert.Equal(t, 2.0, stats.Percentile(95))
+
+	requests, latency := stats.Summary()
+	assert.Equal(t, "5, 2xx: 3 (60.00%), 4xx: 1 (20.00%), 5xx: 1 (20.00%)", requests)
+	assert.Equal(t, "p50 0.300s, p95 2.000s, p99 2.000s, max 2.000s", latency)
+}
+
+func TestAccessStatsReservoir(t *testing.T) {
+	stats := NewAccessStats()
+	for i := 0; i < 3*latencyReservoir; i++ {
+		stats.add(Record{"status": "200", "request_time": strconv.Itoa(i % 100)})
+	}
+	assert.Len(t, stats.Latencies, latencyReservoir)
+	assert.Equal(t, 3*latencyReservoir, stats.LatencyCount)
+	assert.Equal(t, 99.0, stats.MaxLatency)
+
+	sort.Float64s(stats.Latencies)
+	assert.InDelta(t, 50, stats.Percentile(50), 5)
+}
+
+func TestParseAccessThresholds(t *testing.T) {
+	thresholds, err := ParseAccessThresholds("", "")
+	assert.NoError(t, err)
+	assert.Nil(t, thresholds)
+
+	thresholds, err = ParseAccessThresholds("5xx:2", "p95:1")
+	assert.NoError(t, err)
+	assert.Equal(t, &AccessThresholds{StatusClass: "5xx", StatusPercent: 2, Percentile: 95, LatencySecs: 1}, thresholds)
+
+	stats := NewAccessStats()
+	stats.Requests = 100
+	stats.StatusClasses["5xx"] = 3
+	stats.Latencies = []float64{0.5}
+	assert.Equal(t, []string{"5xx 3.00% > 2%"}, thresholds.Exceeded(stats))
+
+	stats.StatusClasses["5xx"] = 1
+	assert.Empty(t, thresholds.Exceeded(stats))
+
+	for _, invalid := range [][2]string{{"5xx", ""}, {"6xx:2", ""}, {"5xx:two", ""}, {"", "95:1"}, {"", "p101:1"}, {"", "p95:slow"}} {
+		_, err := ParseAccessThresholds(invalid[0], invalid[1])
+		assert.Error(t, err, invalid)
+	}
+}
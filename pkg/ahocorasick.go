@@ -0,0 +1,86 @@
+package pkg
+
+// AhoCorasick finds whether any of many literals occurs in a line in a single pass
+// The automaton is built as a dense table over the bytes used by the literals
+type AhoCorasick struct {
+	classes [256]int32 // byte to column of delta, 0 for bytes in no literal
+	width   int32
+	delta   []int32 // state*width + class is the next state
+	out     []bool  // a literal ends in the state, or in one of its suffixes
+}
+
+func NewAhoCorasick(literals []string) *AhoCorasick {
+	a := &AhoCorasick{width: 1}
+	for _, literal := range literals {
+		for i := 0; i < len(literal); i++ {
+			if a.classes[literal[i]] == 0 {
+				a.classes[literal[i]] = a.width
+				a.width++
+			}
+		}
+	}
+
+	// trie, -1 marks a missing edge
+	a.addState()
+	for _, literal := range literals {
+		state := int32(0)
+		for i := 0; i < len(literal); i++ {
+			edge := state*a.width + a.classes[literal[i]]
+			if a.delta[edge] == -1 {
+				a.delta[edge] = a.addState()
+			}
+			state = a.delta[edge]
+		}
+		a.out[state] = true
+	}
+
+	// breadth first, missing edges follow the failure link
+	fail := make([]int32, len(a.out))
+	queue := []int32{}
+	for c := int32(0); c < a.width; c++ {
+		if next := a.delta[c]; next == -1 {
+			a.delta[c] = 0
+		} else {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		a.out[state] = a.out[state] || a.out[fail[state]]
+		for c := int32(0); c < a.width; c++ {
+			edge := state*a.width + c
+			fallback := a.delta[fail[state]*a.width+c]
+			if a.delta[edge] == -1 {
+				a.delta[edge] = fallback
+				continue
+			}
+			fail[a.delta[edge]] = fallback
+			queue = append(queue, a.delta[edge])
+		}
+	}
+	return a
+}
+
+func (a *AhoCorasick) addState() int32 {
+	for c := int32(0); c < a.width; c++ {
+		a.delta = append(a.delta, -1)
+	}
+	a.out = append(a.out, false)
+	return int32(len(a.out) - 1)
+}
+
+// Match reports whether the line contains any of the literals, a nil automaton matches nothing
+func (a *AhoCorasick) Match(line []byte) bool {
+	if a == nil {
+		return false
+	}
+	state := int32(0)
+	for _, b := range line {
+		state = a.delta[state*a.width+a.classes[b]]
+		if a.out[state] {
+			return true
+		}
+	}
+	return false
+}
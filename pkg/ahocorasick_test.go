@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAhoCorasick(t *testing.T) {
+	a := NewAhoCorasick([]string{"he", "she", "his", "hers", "error|warning", "日本"})
+
+	tests := []struct {
+		line     string
+		expected bool
+	}{
+		{line: "ushers", expected: true},
+		{line: "this", expected: true},
+		{line: "ahishe", expected: true},
+		{line: "hxrs", expected: false},
+		{line: "an error|warning here", expected: true},
+		{line: "error or warning", expected: false},
+		{line: "東京と日本", expected: true},
+		{line: "日", expected: false},
+		{line: "", expected: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, a.Match([]byte(tt.line)), tt.line)
+	}
+
+	// suffix links, "abcd" fails over to "bc" once "abx" is ruled out
+	a = NewAhoCorasick([]string{"abx", "bc"})
+	assert.True(t, a.Match([]byte("abcd")))
+	assert.False(t, a.Match([]byte("abab")))
+
+	var none *AhoCorasick
+	assert.False(t, none.Match([]byte("anything")))
+	assert.False(t, NewAhoCorasick(nil).Match([]byte("anything")))
+}
+
+func TestAhoCorasickManyLiterals(t *testing.T) {
+	literals := make([]string, 0, 500)
+	for i := 0; i < 500; i++ {
+		literals = append(literals, strings.Repeat(string(rune('a'+i%26)), 1+i/26)+"-end")
+	}
+	a := NewAhoCorasick(literals)
+	for _, literal := range literals {
+		assert.True(t, a.Match([]byte("prefix "+literal+" suffix")), literal)
+	}
+	assert.False(t, a.Match([]byte("zzzzzzzzzzzzzzzzzzzzzzzz-en")))
+}
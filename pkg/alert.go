@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"fmt"
+	"time"
+)
+
+// AlertState is where a rule and file are in the alert lifecycle, ok → firing → resolved → ok
+type AlertState string
+
+const (
+	AlertOK       AlertState = "ok"
+	AlertFiring   AlertState = "firing"
+	AlertResolved AlertState = "resolved"
+)
+
+// AlertAction is what a scan asks the notifiers to send, all but AlertSuppressed are PagerDuty event actions
+type AlertAction string
+
+const (
+	AlertNone        AlertAction = ""
+	AlertTrigger     AlertAction = "trigger"
+	AlertAcknowledge AlertAction = "acknowledge"
+	AlertResolve     AlertAction = "resolve"
+	AlertSuppressed  AlertAction = "suppressed" // a trigger held back by --cooldown-secs or --renotify-secs
+)
+
+// severityRanks orders the PagerDuty severities, an unknown one ranks lowest
+var severityRanks = map[string]int{
+	"info":     1,
+	"warning":  2,
+	"error":    3,
+	"critical": 4,
+}
+
+// Alert is the lifecycle of one rule and file, kept with the rest of the Watcher state
+type Alert struct {
+	State      AlertState `json:"state"`
+	ClearScans int        `json:"clear_scans"` // scans in a row without the condition while firing
+	NotifiedAt time.Time  `json:"notified_at"` // when the last trigger was sent
+	Suppressed int        `json:"suppressed"`  // triggers held back since NotifiedAt
+	Severity   string     `json:"severity"`    // severity of the last trigger sent
+}
+
+// Next moves the alert on the outcome of a scan, a firing alert resolves after
+// resolveAfter clear scans in a row (0 to never resolve) and with ack is
+// acknowledged on the first of them. A resolve ends the cooldown, the next
+// trigger opens a new incident
+func (a *Alert) Next(firing bool, resolveAfter int, ack bool) AlertAction {
+	if firing {
+		a.State = AlertFiring
+		a.ClearScans = 0
+		return AlertTrigger
+	}
+	if a.State != AlertFiring {
+		a.State = AlertOK
+		a.ClearScans = 0
+		return AlertNone
+	}
+
+	a.ClearScans++
+	switch {
+	case resolveAfter > 0 && a.ClearScans >= resolveAfter:
+		a.State = AlertResolved
+		a.NotifiedAt = time.Time{}
+		a.Suppressed = 0
+		return AlertResolve
+	case ack && a.ClearScans == 1:
+		return AlertAcknowledge
+	}
+	return AlertNone
+}
+
+// Throttle holds a trigger back within cooldown of the last notification and, when
+// the alert was already firing, within renotify. A severity over the last one sent
+// is never held back. A sent trigger returns how many were held back since the previous one
+func (a *Alert) Throttle(now time.Time, cooldown, renotify time.Duration, repeat bool, severity string) (AlertAction, int) {
+	escalated := severityRanks[severity] > severityRanks[a.Severity]
+	if !a.NotifiedAt.IsZero() && !escalated {
+		since := now.Sub(a.NotifiedAt)
+		if since < cooldown || (repeat && since < renotify) {
+			a.Suppressed++
+			return AlertSuppressed, 0
+		}
+	}
+	suppressed := a.Suppressed
+	a.NotifiedAt = now
+	a.Suppressed = 0
+	a.Severity = severity
+	return AlertTrigger, suppressed
+}
+
+// EscalatedSeverity is the tier a firing alert reached with --escalate, warning when
+// --streak is met, error after twice the streak and critical over --critical-percent
+func EscalatedSeverity(result *ScanResult, f Flags) string {
+	switch {
+	case f.CriticalPercent > 0 && result.ErrorPercent >= f.CriticalPercent:
+		return "critical"
+	case StreakRun(result.Streak, f.Min) >= 2*f.Streak:
+		return "error"
+	}
+	return "warning"
+}
+
+// AlertReason returns why the rule alerts on the scanned file, empty when the condition is clear
+func AlertReason(result *ScanResult, f Flags, now time.Time) string {
+	if result.IsFirstScan() {
+		return ""
+	}
+	if f.Absent {
+		return MissingHeartbeat(result, f, now)
+	}
+	if !NonStreakZero(result.Streak, f.Streak, f.Min) || !IsRecentlyModified(result.FileInfo, f.Every) {
+		return ""
+	}
+	return fmt.Sprintf("at least %d matches in each of the last %d scans", f.Min, f.Streak)
+}
@@ -0,0 +1,253 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertNext(t *testing.T) {
+	tests := []struct {
+		name         string
+		firing       []bool
+		resolveAfter int
+		ack          bool
+		expected     []AlertAction
+		state        AlertState
+	}{
+		{
+			name:     "stays ok",
+			firing:   []bool{false, false},
+			expected: []AlertAction{AlertNone, AlertNone},
+			state:    AlertOK,
+		},
+		{
+			name:     "never resolves without resolve after",
+			firing:   []bool{true, true, false, false, false},
+			expected: []AlertAction{AlertTrigger, AlertTrigger, AlertNone, AlertNone, AlertNone},
+			state:    AlertFiring,
+		},
+		{
+			name:         "resolves after clear scans in a row",
+			firing:       []bool{true, false, true, false, false, false},
+			resolveAfter: 2,
+			expected:     []AlertAction{AlertTrigger, AlertNone, AlertTrigger, AlertNone, AlertResolve, AlertNone},
+			state:        AlertOK,
+		},
+		{
+			name:         "acknowledges on the first clear scan",
+			firing:       []bool{true, false, false, false},
+			resolveAfter: 3,
+			ack:          true,
+			expected:     []AlertAction{AlertTrigger, AlertAcknowledge, AlertNone, AlertResolve},
+			state:        AlertResolved,
+		},
+		{
+			name:         "resolves at once",
+			firing:       []bool{true, false},
+			resolveAfter: 1,
+			ack:          true,
+			expected:     []AlertAction{AlertTrigger, AlertResolve},
+			state:        AlertResolved,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := Alert{State: AlertOK}
+			var actions []AlertAction
+			for _, firing := range tt.firing {
+				actions = append(actions, alert.Next(firing, tt.resolveAfter, tt.ack))
+			}
+			assert.Equal(t, tt.expected, actions)
+			assert.Equal(t, tt.state, alert.State)
+		})
+	}
+}
+
+func TestUpdateAlertSurvivesRestart(t *testing.T) {
+	filePath, err := setupTempFile("error\n")
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{Match: "error", Min: 1, Streak: 1, ResolveAfter: 1, StateDir: t.TempDir()}
+	watcher, err := NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, watcher.UpdateAlert(result, f, time.Now()))
+	assert.Equal(t, AlertTrigger, result.Alert)
+	assert.Equal(t, "at least 1 matches in each of the last 1 scans", result.AlertReason)
+
+	// nothing new after a restart, the incident opened before it is resolved
+	watcher, err = NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+	result, err = watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, watcher.UpdateAlert(result, f, time.Now()))
+	assert.Equal(t, AlertResolve, result.Alert)
+	assert.Equal(t, "", result.AlertReason)
+}
+
+func TestNotifyResolved(t *testing.T) {
+	var card teamsCard
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &card)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	f := Flags{Min: 1, Streak: 2, ResolveAfter: 3, MSTeamsHook: server.URL}
+	result := &ScanResult{FilePath: "app.log", Streak: []int{0, 0, 0}}
+	NotifyResolved(context.Background(), result, f, "test", testHTTPClient())
+
+	hostname, _ := os.Hostname()
+	content := card.Attachments[0].Content
+	assert.Equal(t, teamsColorResolved, content.AccentColor)
+	title := content.Body[0].(map[string]any)["text"]
+	assert.Equal(t, "Resolved on "+hostname, title)
+	facts := content.Body[1].(map[string]any)["facts"].([]any)
+	assert.Contains(t, facts, map[string]any{"title": "Status", "value": "alert condition clear for 3 scans"})
+}
+
+func TestAlertThrottle(t *testing.T) {
+	start := time.Now()
+	cooldown := 5 * time.Minute
+	renotify := time.Hour
+
+	alert := Alert{State: AlertOK}
+	action, suppressed := alert.Throttle(start, cooldown, renotify, false, "error")
+	assert.Equal(t, AlertTrigger, action)
+	assert.Equal(t, 0, suppressed)
+
+	// repeats within the cooldown and then within the re-notify interval are held back
+	for _, after := range []time.Duration{time.Minute, 10 * time.Minute, 30 * time.Minute} {
+		action, _ = alert.Throttle(start.Add(after), cooldown, renotify, true, "error")
+		assert.Equal(t, AlertSuppressed, action)
+	}
+
+	// a reminder once the re-notify interval passed
+	action, suppressed = alert.Throttle(start.Add(time.Hour), cooldown, renotify, true, "error")
+	assert.Equal(t, AlertTrigger, action)
+	assert.Equal(t, 3, suppressed)
+
+	// an alert firing anew only waits for the cooldown
+	action, _ = alert.Throttle(start.Add(time.Hour+2*time.Minute), cooldown, renotify, false, "error")
+	assert.Equal(t, AlertSuppressed, action)
+	action, suppressed = alert.Throttle(start.Add(time.Hour+10*time.Minute), cooldown, renotify, false, "error")
+	assert.Equal(t, AlertTrigger, action)
+	assert.Equal(t, 1, suppressed)
+}
+
+func TestUpdateAlertCooldown(t *testing.T) {
+	filePath, err := setupTempFile("error\n")
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{Match: "error", Min: 1, Streak: 1, CooldownSecs: 300}
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	now := time.Now()
+	var actions []AlertAction
+	var suppressed []int
+	for i := 0; i < 4; i++ {
+		watcher, err := NewWatcher(filePath, f, c, nil)
+		assert.NoError(t, err)
+		if i == 0 {
+			watcher.incrementScanCount()
+		}
+		result, err := watcher.Scan(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, watcher.UpdateAlert(result, f, now.Add(time.Duration(i)*2*time.Minute)))
+		actions = append(actions, result.Alert)
+		suppressed = append(suppressed, result.Suppressed)
+
+		file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+		assert.NoError(t, err)
+		_, err = file.WriteString("error\n")
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+	}
+	assert.Equal(t, []AlertAction{AlertTrigger, AlertSuppressed, AlertSuppressed, AlertTrigger}, actions)
+	assert.Equal(t, []int{0, 0, 0, 2}, suppressed)
+}
+
+func TestAlertRefiresAfterResolve(t *testing.T) {
+	start := time.Now()
+	cooldown := 5 * time.Minute
+	alert := Alert{State: AlertOK}
+
+	assert.Equal(t, AlertTrigger, alert.Next(true, 1, false))
+	action, _ := alert.Throttle(start, cooldown, 0, false, "error")
+	assert.Equal(t, AlertTrigger, action)
+	assert.Equal(t, AlertResolve, alert.Next(false, 1, false))
+
+	// the incident was resolved, firing again within the cooldown opens a new one
+	assert.Equal(t, AlertTrigger, alert.Next(true, 1, false))
+	action, suppressed := alert.Throttle(start.Add(time.Minute), cooldown, 0, false, "error")
+	assert.Equal(t, AlertTrigger, action)
+	assert.Equal(t, 0, suppressed)
+}
+
+func TestSameIncident(t *testing.T) {
+	rule := Flags{Name: "errors", Match: "error", PagerDutyKey: "key"}
+	changed := rule
+	changed.Match = "error|fatal"
+	assert.True(t, SameIncident(rule, changed, "app.log", "error"))
+
+	changed.PagerDutyDedupKey = "{rule}:{file}:{glob}:x"
+	assert.False(t, SameIncident(rule, changed, "app.log", "error"))
+
+	// a kept alert is what the new rule starts from
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	KeepAlert("app.log", &Alert{State: AlertFiring, Severity: "error"}, c)
+	assert.Equal(t, &Alert{State: AlertFiring, Severity: "error"}, StoredAlert(changed, "app.log", c))
+}
+
+func TestAlertThrottleEscalation(t *testing.T) {
+	start := time.Now()
+	alert := Alert{State: AlertOK}
+	action, _ := alert.Throttle(start, time.Hour, 0, false, "warning")
+	assert.Equal(t, AlertTrigger, action)
+
+	action, _ = alert.Throttle(start.Add(time.Minute), time.Hour, 0, true, "warning")
+	assert.Equal(t, AlertSuppressed, action)
+
+	// a higher tier goes out within the cooldown, the same tier again does not
+	action, suppressed := alert.Throttle(start.Add(2*time.Minute), time.Hour, 0, true, "error")
+	assert.Equal(t, AlertTrigger, action)
+	assert.Equal(t, 1, suppressed)
+	action, _ = alert.Throttle(start.Add(3*time.Minute), time.Hour, 0, true, "error")
+	assert.Equal(t, AlertSuppressed, action)
+	action, _ = alert.Throttle(start.Add(4*time.Minute), time.Hour, 0, true, "warning")
+	assert.Equal(t, AlertSuppressed, action)
+}
+
+func TestEscalatedSeverity(t *testing.T) {
+	f := Flags{Min: 1, Streak: 2, CriticalPercent: 50}
+	tests := []struct {
+		name     string
+		streak   []int
+		percent  float64
+		expected string
+	}{
+		{name: "streak met", streak: []int{0, 0, 3, 1}, percent: 10, expected: "warning"},
+		{name: "twice the streak", streak: []int{0, 2, 3, 1, 4}, percent: 10, expected: "error"},
+		{name: "over the ceiling", streak: []int{0, 0, 3, 1}, percent: 60, expected: "critical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &ScanResult{Streak: tt.streak, ErrorPercent: tt.percent}
+			assert.Equal(t, tt.expected, EscalatedSeverity(result, f))
+		})
+	}
+}
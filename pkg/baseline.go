@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// baselineAlpha is the weight of the latest scan in the moving mean and variance
+const baselineAlpha = 0.1
+
+// baselineWarmup is the number of scans a baseline learns from before it can flag an outlier
+const baselineWarmup = 10
+
+// baselineMinStdDev keeps a quiet file from flagging every single match, a count is
+// never scored as more than its distance from the mean
+const baselineMinStdDev = 1.0
+
+// Baseline is the exponentially weighted mean and variance of the matches per scan
+type Baseline struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Samples  int     `json:"samples"`
+}
+
+// Add moves the baseline towards count
+func (b *Baseline) Add(count float64) {
+	if b.Samples == 0 {
+		b.Mean = count
+		b.Variance = 0
+		b.Samples = 1
+		return
+	}
+	diff := count - b.Mean
+	incr := baselineAlpha * diff
+	b.Mean += incr
+	b.Variance = (1 - baselineAlpha) * (b.Variance + diff*incr)
+	b.Samples++
+}
+
+// StdDev is the standard deviation of the baseline, at least baselineMinStdDev
+func (b *Baseline) StdDev() float64 {
+	return math.Max(math.Sqrt(b.Variance), baselineMinStdDev)
+}
+
+// Baselines holds one Baseline, or one per hour of the day for an hourly profile
+type Baselines []Baseline
+
+// NewBaselines returns empty baselines, 24 of them when hourly
+func NewBaselines(hourly bool) Baselines {
+	if hourly {
+		return make(Baselines, 24)
+	}
+	return make(Baselines, 1)
+}
+
+// At returns the baseline of the hour of t in an hourly profile
+func (b Baselines) At(t time.Time) *Baseline {
+	if len(b) == 24 {
+		return &b[t.Hour()]
+	}
+	return &b[0]
+}
+
+// Anomaly is how the matches of a scan compare to the baseline before it
+type Anomaly struct {
+	Actual   int
+	Expected float64 // mean matches per scan
+	StdDev   float64
+	Score    float64 // standard deviations over the mean, 0 while the baseline warms up
+	Samples  int     // scans the baseline learned from
+}
+
+// Score compares count to the baseline, then adds it to the baseline
+func (b *Baseline) Score(count int) *Anomaly {
+	anomaly := &Anomaly{
+		Actual:   count,
+		Expected: b.Mean,
+		StdDev:   b.StdDev(),
+		Samples:  b.Samples,
+	}
+	if b.Samples >= baselineWarmup {
+		anomaly.Score = (float64(count) - b.Mean) / anomaly.StdDev
+	}
+	b.Add(float64(count))
+	return anomaly
+}
+
+// String is the expected vs actual line shown in notifications
+func (a *Anomaly) String() string {
+	if a.Samples < baselineWarmup {
+		return fmt.Sprintf("actual %d, baseline learning (%d of %d scans)", a.Actual, a.Samples, baselineWarmup)
+	}
+	return fmt.Sprintf("expected %.1f ± %.1f, actual %d, %.1fσ from the baseline of %d scans", a.Expected, a.StdDev, a.Actual, a.Score, a.Samples)
+}
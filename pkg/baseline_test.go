@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaselineScore(t *testing.T) {
+	var b Baseline
+	for i := 0; i < baselineWarmup; i++ {
+		anomaly := b.Score(10 + i%3)
+		assert.Equal(t, 0.0, anomaly.Score)
+	}
+	assert.InDelta(t, 10.9, b.Mean, 0.5)
+
+	normal := b.Score(11)
+	assert.Less(t, normal.Score, 1.0)
+
+	outlier := b.Score(40)
+	assert.Greater(t, outlier.Score, 3.0)
+	assert.Equal(t, 40, outlier.Actual)
+	assert.Contains(t, outlier.String(), "actual 40")
+}
+
+func TestBaselineQuietFile(t *testing.T) {
+	var b Baseline
+	for i := 0; i < baselineWarmup; i++ {
+		b.Score(0)
+	}
+	// no variance at all, a single match is one standard deviation off
+	assert.Equal(t, 1.0, b.Score(1).Score)
+}
+
+func TestBaselinesAt(t *testing.T) {
+	at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	hourly := NewBaselines(true)
+	hourly.At(at).Add(5)
+	assert.Equal(t, 1, hourly[15].Samples)
+	assert.Equal(t, 0, hourly[14].Samples)
+
+	single := NewBaselines(false)
+	single.At(at).Add(5)
+	assert.Equal(t, 1, single[0].Samples)
+}
+
+func TestScanAnomaly(t *testing.T) {
+	filePath, err := setupTempFile("")
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{Match: "error", Min: 1, Streak: 1, Anomaly: 3, StateDir: t.TempDir()}
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	scan := func(lines string) *ScanResult {
+		file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+		assert.NoError(t, err)
+		_, err = file.WriteString(lines)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+
+		watcher, err := NewWatcher(filePath, f, c, nil)
+		assert.NoError(t, err)
+		result, err := watcher.Scan(context.Background())
+		assert.NoError(t, err)
+		return result
+	}
+
+	scan("")
+	for i := 0; i < baselineWarmup; i++ {
+		result := scan(strings.Repeat("error\n", 5))
+		assert.Equal(t, 0, result.Streak[len(result.Streak)-1], "usual errors do not count")
+	}
+
+	result := scan(strings.Repeat("error\n", 50))
+	assert.Equal(t, 50, result.Streak[len(result.Streak)-1])
+	assert.Equal(t, 5.0, result.Anomaly.Expected)
+	assert.Equal(t, 50, result.Anomaly.Actual)
+
+	// the baseline survives a restart
+	c = cache.New(cache.NoExpiration, cache.NoExpiration)
+	result = scan(strings.Repeat("error\n", 5))
+	assert.Equal(t, baselineWarmup+1, result.Anomaly.Samples)
+}
@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+const compressedContent = "line1\nerror:1\nignore error:1\nerror:2\n"
+
+func gzipBytes(t *testing.T, content string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, content string) []byte {
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	assert.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     []byte
+		expected Compression
+	}{
+		{name: "plain text", head: []byte("line1\n"), expected: CompressionNone},
+		{name: "empty", head: []byte{}, expected: CompressionNone},
+		{name: "gzip", head: gzipBytes(t, "x"), expected: CompressionGzip},
+		{name: "zstd", head: zstdBytes(t, "x"), expected: CompressionZstd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DetectCompression(tt.head))
+		})
+	}
+}
+
+func TestScanCompressedFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "access.log.2.gz", content: gzipBytes(t, compressedContent)},
+		{name: "access.log.3.zst", content: zstdBytes(t, compressedContent)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.name)
+			assert.NoError(t, os.WriteFile(filePath, tt.content, 0600))
+
+			isText, err := IsTextFile(filePath)
+			assert.NoError(t, err)
+			assert.True(t, isText)
+
+			f := Flags{Match: "error", Ignore: "ignore"}
+			watcher, err := NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+			assert.NoError(t, err)
+
+			// an archive can not grow, the first scan of a fresh watcher matches its lines
+			result, err := watcher.Scan(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 2, result.ErrorCount)
+			assert.Equal(t, "error:1", result.FirstLine)
+			assert.Equal(t, "error:2", result.LastLine)
+
+			// the archive is fully consumed, nothing is counted twice
+			result, err = watcher.Scan(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 0, result.ErrorCount)
+		})
+	}
+}
+
+func TestScanTruncatedArchiveIsRetried(t *testing.T) {
+	content := gzipBytes(t, compressedContent)
+	filePath := filepath.Join(t.TempDir(), "access.log.1.gz")
+	assert.NoError(t, os.WriteFile(filePath, content[:len(content)/2], 0600))
+
+	f := Flags{Match: "error"}
+	watcher, err := NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+
+	_, err = watcher.Scan(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, int64(0), watcher.lastFileSize)
+}
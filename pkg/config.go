@@ -0,0 +1,167 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rulesConfig is the layout of the --config file
+//
+//	rules:
+//	  - name: oom
+//	    file-path: /var/log/app/*.log
+//	    match: OutOfMemory
+//	    severity: critical
+type rulesConfig struct {
+	Rules []yaml.Node `yaml:"rules"`
+}
+
+// LoadRules returns the rules to watch, the flags alone are one rule when no --config is given
+func LoadRules(f Flags) ([]Flags, error) {
+	if f.Config == "" {
+		if err := checkRule(f); err != nil {
+			return nil, err
+		}
+		return []Flags{f}, nil
+	}
+
+	data, err := os.ReadFile(f.Config)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data, f)
+}
+
+// ParseRules decodes every rule on top of a copy of base, so unset keys keep the flag values
+func ParseRules(data []byte, base Flags) ([]Flags, error) {
+	// strict pass, so a typo in a key is an error instead of a silently ignored setting
+	var strict struct {
+		Rules []Flags `yaml:"rules"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&strict); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	var cfg rulesConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, errors.New("invalid config: no rules")
+	}
+
+	rules := make([]Flags, 0, len(cfg.Rules))
+	names := make(map[string]struct{})
+	for i := range cfg.Rules {
+		rule := base
+		if err := cfg.Rules[i].Decode(&rule); err != nil {
+			return nil, fmt.Errorf("invalid rule #%d: %w", i+1, err)
+		}
+		if err := validateRule(rule); err != nil {
+			return nil, fmt.Errorf("invalid rule #%d: %w", i+1, err)
+		}
+		if _, ok := names[rule.Name]; ok {
+			return nil, fmt.Errorf("invalid rule #%d: duplicate name %q", i+1, rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func validateRule(rule Flags) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+	if rule.FilePath == "" {
+		return fmt.Errorf("%s: file-path is required", rule.Name)
+	}
+	if _, err := splitAndCompilePattern(rule.Match); err != nil {
+		return fmt.Errorf("%s: match: %w", rule.Name, err)
+	}
+	if _, err := rule.NamedMatch.Compile(); err != nil {
+		return fmt.Errorf("%s: named-match: %w", rule.Name, err)
+	}
+	if _, err := splitAndCompilePattern(rule.Ignore); err != nil {
+		return fmt.Errorf("%s: ignore: %w", rule.Name, err)
+	}
+	if _, err := NewLineParser(rule.Format); err != nil {
+		return fmt.Errorf("%s: %w", rule.Name, err)
+	}
+	if _, err := ParseCondition(rule.Where); err != nil {
+		return fmt.Errorf("%s: where: %w", rule.Name, err)
+	}
+	if _, err := ParseCondition(rule.IgnoreWhere); err != nil {
+		return fmt.Errorf("%s: ignore-where: %w", rule.Name, err)
+	}
+	if _, err := ParseAccessThresholds(rule.StatusPercent, rule.Latency); err != nil {
+		return fmt.Errorf("%s: %w", rule.Name, err)
+	}
+	if _, err := NewMultiline(rule.MultilineStart, rule.MultilineContinue, rule.MultilineMaxBytes); err != nil {
+		return fmt.Errorf("%s: multiline: %w", rule.Name, err)
+	}
+	if err := checkRule(rule); err != nil {
+		return fmt.Errorf("%s: %w", rule.Name, err)
+	}
+	return nil
+}
+
+// checkRule rejects settings that are valid on their own but silently do nothing together
+func checkRule(rule Flags) error {
+	if err := checkDedupKey(rule); err != nil {
+		return err
+	}
+	// a scan under the ratios counts 0 matches, which a min of 0 still meets
+	if (rule.MinPercent > 0 || rule.MinRate > 0) && rule.Min < 1 {
+		return errors.New("min-percent and min-rate need a min of at least 1")
+	}
+	// text lines have no fields, the predicates would match nothing
+	if (rule.Format == "" || rule.Format == FormatText) && (rule.Where != "" || rule.IgnoreWhere != "" || rule.Fields != "") {
+		return errors.New("where, ignore-where and fields need a format other than text")
+	}
+	// a followed file is only scanned when written to, a quiet one never gets the scans that clear it
+	if rule.Follow && rule.Every == 0 && (rule.ResolveAfter > 0 || rule.Absent) {
+		return errors.New("resolve-after and absent need every with follow")
+	}
+	return nil
+}
+
+// checkDedupKey rejects {severity} with --escalate, every tier would open an incident of
+// its own and a resolve only closes the one of the last tier sent
+func checkDedupKey(rule Flags) error {
+	if rule.Escalate && strings.Contains(rule.PagerDutyDedupKey, "{severity}") {
+		return errors.New("pagerduty-dedupkey: {severity} can not be used with escalate")
+	}
+	return nil
+}
+
+// DiffRules compares rules by name, a rule is changed when any of its settings differ
+func DiffRules(oldRules, newRules []Flags) (added, removed, changed []string) {
+	previous := make(map[string]Flags, len(oldRules))
+	for _, rule := range oldRules {
+		previous[rule.Name] = rule
+	}
+	for _, rule := range newRules {
+		old, ok := previous[rule.Name]
+		switch {
+		case !ok:
+			added = append(added, rule.Name)
+		case old != rule:
+			changed = append(changed, rule.Name)
+		}
+		delete(previous, rule.Name)
+	}
+	for _, rule := range oldRules {
+		if _, ok := previous[rule.Name]; ok {
+			removed = append(removed, rule.Name)
+		}
+	}
+	return added, removed, changed
+}
@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	base := Flags{
+		Match:        ".*",
+		Min:          1,
+		Streak:       1,
+		Severity:     "error",
+		FilePathsCap: 100,
+		MSTeamsHook:  "https://example.com/hook",
+		Every:        60,
+	}
+	config := `
+rules:
+  - name: oom
+    file-path: /var/log/app/*.log
+    match: OutOfMemory
+    severity: critical
+    streak: 2
+  - name: db
+    file-path: /var/log/db.log
+    match: Connection reset
+    ignore: retrying
+    ms-teams-hook: https://example.com/db-hook
+`
+	rules, err := ParseRules([]byte(config), base)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+
+	assert.Equal(t, "oom", rules[0].Name)
+	assert.Equal(t, "/var/log/app/*.log", rules[0].FilePath)
+	assert.Equal(t, "OutOfMemory", rules[0].Match)
+	assert.Equal(t, "critical", rules[0].Severity)
+	assert.Equal(t, 2, rules[0].Streak)
+	// unset keys keep the flag values
+	assert.Equal(t, 1, rules[0].Min)
+	assert.Equal(t, 100, rules[0].FilePathsCap)
+	assert.Equal(t, "https://example.com/hook", rules[0].MSTeamsHook)
+	assert.Equal(t, uint64(60), rules[0].Every)
+
+	assert.Equal(t, "db", rules[1].Name)
+	assert.Equal(t, "retrying", rules[1].Ignore)
+	assert.Equal(t, "error", rules[1].Severity)
+	assert.Equal(t, "https://example.com/db-hook", rules[1].MSTeamsHook)
+}
+
+func TestParseRules_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{name: "no rules", config: `rules: []`},
+		{name: "not yaml", config: `rules: [`},
+		{name: "unknown key", config: "rules:\n  - name: a\n    file-path: a.log\n    mtach: error\n"},
+		{name: "process wide key", config: "rules:\n  - name: a\n    file-path: a.log\n    every: 10\n"},
+		{name: "missing name", config: "rules:\n  - file-path: a.log\n"},
+		{name: "missing file path", config: "rules:\n  - name: a\n"},
+		{name: "duplicate name", config: "rules:\n  - name: a\n    file-path: a.log\n  - name: a\n    file-path: b.log\n"},
+		{name: "bad regex", config: "rules:\n  - name: a\n    file-path: a.log\n    match: '(error'\n"},
+		{name: "bad named regex", config: "rules:\n  - name: a\n    file-path: a.log\n    named-match:\n      oom: '(error'\n"},
+		{name: "min percent without min", config: "rules:\n  - name: a\n    file-path: a.log\n    min: 0\n    min-percent: 5\n"},
+		{name: "where on text lines", config: "rules:\n  - name: a\n    file-path: a.log\n    where: status >= 500\n"},
+		{name: "severity key with escalate", config: "rules:\n  - name: a\n    file-path: a.log\n    escalate: true\n    pagerduty-dedupkey: '{file}:{severity}'\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(tt.config), Flags{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	f := Flags{FilePath: "app.log", Match: "error"}
+	rules, err := LoadRules(f)
+	assert.NoError(t, err)
+	assert.Equal(t, []Flags{f}, rules)
+
+	escalating := f
+	escalating.Escalate = true
+	escalating.PagerDutyDedupKey = "{hostname}:{severity}"
+	_, err = LoadRules(escalating)
+	assert.Error(t, err)
+
+	ratio := f
+	ratio.Min = 0
+	ratio.MinRate = 2
+	_, err = LoadRules(ratio)
+	assert.Error(t, err)
+
+	fields := f
+	fields.Format = FormatText
+	fields.Fields = "status"
+	_, err = LoadRules(fields)
+	assert.Error(t, err)
+	fields.Format = FormatJSON
+	_, err = LoadRules(fields)
+	assert.NoError(t, err)
+
+	following := f
+	following.Follow = true
+	following.ResolveAfter = 3
+	_, err = LoadRules(following)
+	assert.Error(t, err)
+	following.Every = 60
+	_, err = LoadRules(following)
+	assert.NoError(t, err)
+
+	f.Config = filepath.Join(t.TempDir(), "rules.yaml")
+	assert.NoError(t, os.WriteFile(f.Config, []byte("rules:\n  - name: a\n    file-path: a.log\n"), 0600))
+	rules, err = LoadRules(f)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, "a.log", rules[0].FilePath)
+	assert.Equal(t, "error", rules[0].Match)
+}
+
+func TestStateKey(t *testing.T) {
+	assert.Equal(t, "app.log", StateKey(Flags{}, "app.log"))
+	assert.Equal(t, "oom:app.log", StateKey(Flags{Name: "oom"}, "app.log"))
+}
+
+func TestDiffRules(t *testing.T) {
+	oldRules := []Flags{
+		{Name: "oom", FilePath: "app.log", Match: "OutOfMemory"},
+		{Name: "db", FilePath: "app.log", Match: "Connection reset"},
+		{Name: "gone", FilePath: "old.log"},
+	}
+	newRules := []Flags{
+		{Name: "oom", FilePath: "app.log", Match: "OutOfMemory"},
+		{Name: "db", FilePath: "app.log", Match: "Connection (reset|refused)"},
+		{Name: "new", FilePath: "new.log"},
+	}
+
+	added, removed, changed := DiffRules(oldRules, newRules)
+	assert.Equal(t, []string{"new"}, added)
+	assert.Equal(t, []string{"gone"}, removed)
+	assert.Equal(t, []string{"db"}, changed)
+}
@@ -0,0 +1,236 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// digestDedupKey is the PagerDuty incident of the digests of a host, unless --pagerduty-dedupkey is given
+const digestDedupKey = "go-watch-logs:{hostname}:digest"
+
+// digestFile stands for the file in a --pagerduty-dedupkey template of a digest
+const digestFile = "digest"
+
+// DigestEntry is one rule and file in a digest
+type DigestEntry struct {
+	Rule   Flags
+	Result *ScanResult
+}
+
+// Digest collects the alerts of one cycle that go to the same notifiers and PagerDuty incident
+type Digest struct {
+	Flags        Flags  // notifiers of the digest, from the first rule added
+	DedupKey     string // PagerDuty incident of the digest, empty without --pagerduty-key
+	Triggered    []DigestEntry
+	Resolved     []DigestEntry
+	Acknowledged []DigestEntry
+	Firing       bool // a file the digest covers is firing, clearing or not
+	Alerting     bool // a file the digest covers is firing and not clearing
+}
+
+// Digests are the digests of a cycle by notifiers, in the order the rules were added
+type Digests []*Digest
+
+// Add takes a trigger, resolve or acknowledge into the digest of the notifiers of
+// the rule, other results are not taken and are reported on their own
+func (ds *Digests) Add(rule Flags, result *ScanResult) bool {
+	entry := DigestEntry{Rule: rule, Result: result}
+	switch result.Alert {
+	case AlertTrigger:
+		d := ds.of(rule)
+		d.Triggered = append(d.Triggered, entry)
+	case AlertResolve:
+		d := ds.of(rule)
+		d.Resolved = append(d.Resolved, entry)
+	case AlertAcknowledge:
+		d := ds.of(rule)
+		d.Acknowledged = append(d.Acknowledged, entry)
+	default:
+		return false
+	}
+	return true
+}
+
+func (ds *Digests) of(rule Flags) *Digest {
+	for _, d := range *ds {
+		if d.Covers(rule) {
+			return d
+		}
+	}
+	d := &Digest{Flags: rule, DedupKey: digestKey(rule)}
+	*ds = append(*ds, d)
+	return d
+}
+
+// Covers checks whether the alerts of the rule go into the digest
+func (d *Digest) Covers(rule Flags) bool {
+	return d.Flags.MSTeamsHook == rule.MSTeamsHook &&
+		d.Flags.PagerDutyKey == rule.PagerDutyKey &&
+		d.DedupKey == digestKey(rule)
+}
+
+// Track notes the alert of a file the digest covers, scanned in the cycle or not,
+// the PagerDuty incident of the digest is only closed once none of them is firing
+func (d *Digest) Track(alert *Alert) {
+	if alert.State != AlertFiring {
+		return
+	}
+	d.Firing = true
+	if alert.ClearScans == 0 {
+		d.Alerting = true
+	}
+}
+
+// digestKey expands the dedup key of the digest for the rule, {file} is digest
+func digestKey(rule Flags) string {
+	if rule.PagerDutyKey == "" {
+		return ""
+	}
+	template := rule.PagerDutyDedupKey
+	if template == "" {
+		template = digestDedupKey
+	}
+	hostname, _ := os.Hostname()
+	return expandDedupKey(template, rule, hostname, digestFile, "")
+}
+
+// Severity is the highest severity of the triggered files
+func (d *Digest) Severity() string {
+	severity := ""
+	for _, e := range d.Triggered {
+		if severity == "" || severityRanks[e.Result.Severity] > severityRanks[severity] {
+			severity = e.Result.Severity
+		}
+	}
+	return severity
+}
+
+// NotifyDigest sends one Teams card and one PagerDuty event for the files of the digest,
+// the PagerDuty incident is acknowledged once no file of the digest is alerting and
+// resolves once none is firing. Track every file the digest covers before
+func NotifyDigest(ctx context.Context, d *Digest, version string, httpClient *http.Client) {
+	hostname, _ := os.Hostname()
+
+	var action AlertAction
+	var title, color string
+	switch {
+	case len(d.Triggered) > 0:
+		action = AlertTrigger
+		title = fmt.Sprintf("%d files alerting on %s", len(d.Triggered), hostname)
+		color = teamsColor(d.Severity())
+	case len(d.Resolved) > 0:
+		action = AlertResolve
+		title = fmt.Sprintf("%d files resolved on %s", len(d.Resolved), hostname)
+		color = teamsColorResolved
+	case len(d.Acknowledged) > 0:
+		action = AlertAcknowledge
+		title = fmt.Sprintf("%d files clearing on %s", len(d.Acknowledged), hostname)
+	default:
+		return
+	}
+	details := digestDetails(d, version)
+
+	var logDetails []any // nolint: prealloc
+	for _, detail := range details {
+		logDetails = append(logDetails, detail.Label, detail.Message)
+	}
+	slog.Debug("Sending Digest Notify", logDetails...)
+
+	if d.Flags.MSTeamsHook != "" && action != AlertAcknowledge {
+		slog.Info("Sending digest to MS Teams", "triggered", len(d.Triggered), "resolved", len(d.Resolved))
+		err := sendToTeams(ctx, title, color, details, d.Flags.GitURL, d.Flags.MSTeamsHook, httpClient)
+		if err != nil {
+			slog.Warn("Error sending digest to Teams", "error", err.Error())
+		} else {
+			slog.Info("Successfully sent digest to MS Teams")
+		}
+	}
+
+	if d.Flags.PagerDutyKey == "" || (action == AlertResolve && d.Firing) || (action == AlertAcknowledge && d.Alerting) {
+		return
+	}
+	slog.Info("Sending digest to PagerDuty", "action", action, "dedupKey", d.DedupKey)
+
+	pdetails := map[string]any{
+		"go-watch-log version": version,
+		"Files":                digestFiles(d.Triggered),
+	}
+	if len(d.Resolved) > 0 {
+		pdetails["Resolved"] = digestFiles(d.Resolved)
+	}
+	severity := d.Severity()
+	if severity == "" {
+		severity = d.Flags.Severity
+	}
+	pd := NewPagerDuty()
+	status, err := pd.SendEvent(ctx, action, title, pdetails, d.Flags.PagerDutyKey, severity, d.DedupKey, httpClient)
+	if err != nil {
+		slog.Warn("Error sending digest to PagerDuty", "error", err.Error())
+	} else {
+		slog.Info("Successfully sent digest to PagerDuty", "status", status)
+	}
+}
+
+// digestDetails is the per file table of the Teams card, one row per file
+func digestDetails(d *Digest, version string) []Details {
+	details := []Details{{
+		Label:   "go-watch-log version",
+		Message: version,
+	}}
+	for _, e := range d.Triggered {
+		r := e.Result
+		if e.Rule.Absent {
+			details = append(details, Details{
+				Label:   digestLabel(e),
+				Message: "missing heartbeat, " + r.AlertReason,
+			})
+			continue
+		}
+		details = append(details, Details{
+			Label: digestLabel(e),
+			Message: fmt.Sprintf(
+				"%s errors (%.2f%%), %s, %s\n\r%s",
+				NumberToK(r.ErrorCount),
+				r.ErrorPercent,
+				r.Severity,
+				StreakSymbols(r.Streak, e.Rule.Streak, e.Rule.Min),
+				Truncate(r.FirstLine, TruncateMax),
+			),
+		})
+	}
+	for _, e := range d.Resolved {
+		details = append(details, Details{
+			Label:   digestLabel(e),
+			Message: "resolved, " + StreakSymbols(e.Result.Streak, e.Rule.Streak, e.Rule.Min),
+		})
+	}
+	return details
+}
+
+func digestLabel(e DigestEntry) string {
+	if e.Rule.Name == "" {
+		return e.Result.FilePath
+	}
+	return e.Rule.Name + ": " + e.Result.FilePath
+}
+
+// digestFiles are the PagerDuty custom details of the files, structured for the incident view
+func digestFiles(entries []DigestEntry) []map[string]any {
+	files := make([]map[string]any, 0, len(entries))
+	for _, e := range entries {
+		r := e.Result
+		files = append(files, map[string]any{
+			"rule":       e.Rule.Name,
+			"file":       r.FilePath,
+			"count":      r.ErrorCount,
+			"percent":    r.ErrorPercent,
+			"severity":   r.Severity,
+			"streak":     StreakSymbols(r.Streak, e.Rule.Streak, e.Rule.Min),
+			"first line": Truncate(r.FirstLine, TruncateMax),
+		})
+	}
+	return files
+}
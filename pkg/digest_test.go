@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigestsAdd(t *testing.T) {
+	teams := Flags{Name: "errors", MSTeamsHook: "https://teams", Min: 1, Streak: 1}
+	pager := Flags{Name: "oom", PagerDutyKey: "key", Min: 1, Streak: 1}
+
+	var digests Digests
+	assert.True(t, digests.Add(teams, &ScanResult{FilePath: "a.log", Alert: AlertTrigger, AlertState: AlertFiring, Severity: "warning"}))
+	assert.True(t, digests.Add(teams, &ScanResult{FilePath: "b.log", Alert: AlertTrigger, AlertState: AlertFiring, Severity: "critical"}))
+	assert.True(t, digests.Add(teams, &ScanResult{FilePath: "c.log", Alert: AlertResolve, AlertState: AlertResolved}))
+	assert.False(t, digests.Add(teams, &ScanResult{FilePath: "d.log", Alert: AlertSuppressed, AlertState: AlertFiring}))
+	assert.False(t, digests.Add(pager, &ScanResult{FilePath: "e.log", Alert: AlertNone, AlertState: AlertOK}))
+
+	assert.Len(t, digests, 1)
+	assert.Len(t, digests[0].Triggered, 2)
+	assert.Len(t, digests[0].Resolved, 1)
+	assert.Equal(t, "critical", digests[0].Severity())
+
+	// a dedup key with {rule} splits rules with the same notifiers
+	named := Flags{PagerDutyKey: "key", PagerDutyDedupKey: "{rule}:{file}", Min: 1, Streak: 1}
+	named.Name = "5xx"
+	assert.True(t, digests.Add(named, &ScanResult{FilePath: "f.log", Alert: AlertTrigger}))
+	named.Name = "timeouts"
+	assert.True(t, digests.Add(named, &ScanResult{FilePath: "g.log", Alert: AlertTrigger}))
+	assert.Len(t, digests, 3)
+	assert.Equal(t, "5xx:digest", digests[1].DedupKey)
+	assert.Equal(t, "timeouts:digest", digests[2].DedupKey)
+	assert.Equal(t, "", digests[2].Severity())
+}
+
+func TestDigestTrack(t *testing.T) {
+	var d Digest
+	d.Track(&Alert{State: AlertOK})
+	d.Track(&Alert{State: AlertResolved})
+	assert.False(t, d.Firing)
+	d.Track(&Alert{State: AlertFiring, ClearScans: 1})
+	assert.True(t, d.Firing)
+	assert.False(t, d.Alerting)
+	d.Track(&Alert{State: AlertFiring})
+	assert.True(t, d.Alerting)
+}
+
+// pagerDutyEvents records the events sent to PagerDuty
+type pagerDutyEvents []map[string]any
+
+func (p *pagerDutyEvents) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(r.Body)
+	var event map[string]any
+	_ = json.Unmarshal(body, &event)
+	*p = append(*p, event)
+	return &http.Response{
+		StatusCode: http.StatusAccepted,
+		Body:       io.NopCloser(strings.NewReader(`{"status":"success","message":"Event processed"}`)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+func TestNotifyDigestAcknowledge(t *testing.T) {
+	filePath, err := setupTempFile("error\n")
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{Match: "error", Min: 1, Streak: 1, ResolveAfter: 3, PagerDutyAck: true, PagerDutyKey: "key", Digest: true}
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	var events pagerDutyEvents
+	client := &http.Client{Transport: &events}
+	for i := 0; i < 2; i++ {
+		watcher, err := NewWatcher(filePath, f, c, nil)
+		assert.NoError(t, err)
+		if i == 0 {
+			watcher.incrementScanCount()
+		}
+		result, err := watcher.Scan(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, watcher.UpdateAlert(result, f, time.Now()))
+
+		var digests Digests
+		assert.True(t, digests.Add(f, result))
+		digests[0].Track(StoredAlert(f, filePath, c))
+		NotifyDigest(context.Background(), digests[0], "test", client)
+	}
+
+	// the acknowledge goes to the incident of the digest, not one of the file
+	hostname, _ := os.Hostname()
+	assert.Len(t, events, 2)
+	assert.Equal(t, "trigger", events[0]["event_action"])
+	assert.Equal(t, "acknowledge", events[1]["event_action"])
+	assert.Equal(t, "go-watch-logs:"+hostname+":digest", events[1]["dedup_key"])
+}
+
+func TestNotifyDigestResolveWhileFiring(t *testing.T) {
+	var events pagerDutyEvents
+	client := &http.Client{Transport: &events}
+	rule := Flags{Min: 1, Streak: 1, ResolveAfter: 1, PagerDutyKey: "key"}
+
+	var digests Digests
+	digests.Add(rule, &ScanResult{FilePath: "a.log", Alert: AlertResolve, AlertState: AlertResolved})
+	// b.log was not scanned in the cycle and is still firing
+	digests[0].Track(&Alert{State: AlertFiring})
+	NotifyDigest(context.Background(), digests[0], "test", client)
+	assert.Empty(t, events)
+
+	digests[0].Firing = false
+	NotifyDigest(context.Background(), digests[0], "test", client)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "resolve", events[0]["event_action"])
+}
+
+func TestNotifyDigest(t *testing.T) {
+	var cards []teamsCard
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var card teamsCard
+		_ = json.Unmarshal(body, &card)
+		cards = append(cards, card)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	rule := Flags{Name: "errors", MSTeamsHook: server.URL, Min: 1, Streak: 1}
+	var digests Digests
+	for _, filePath := range []string{"a.log", "b.log", "c.log"} {
+		digests.Add(rule, &ScanResult{
+			FilePath:     filePath,
+			ErrorCount:   3,
+			ErrorPercent: 1.5,
+			Severity:     "error",
+			Streak:       []int{0, 3},
+			FirstLine:    "connection refused",
+			Alert:        AlertTrigger,
+			AlertState:   AlertFiring,
+		})
+	}
+	for _, digest := range digests {
+		NotifyDigest(context.Background(), digest, "test", testHTTPClient())
+	}
+
+	hostname, _ := os.Hostname()
+	assert.Len(t, cards, 1)
+	content := cards[0].Attachments[0].Content
+	assert.Equal(t, teamsColorAlert, content.AccentColor)
+	assert.Equal(t, "3 files alerting on "+hostname, content.Body[0].(map[string]any)["text"])
+	facts := content.Body[1].(map[string]any)["facts"].([]any)
+	assert.Len(t, facts, 4)
+	row := facts[2].(map[string]any)
+	assert.Equal(t, "errors: b.log", row["title"])
+	assert.True(t, strings.HasPrefix(row["value"].(string), "3 errors (1.50%), error, "))
+	assert.Contains(t, row["value"], "connection refused")
+}
@@ -0,0 +1,133 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fingerprintSize is how much of the head of a file identifies its content
+const fingerprintSize = 1024
+
+// rotationSlack tolerates the trailing newline counted for an unterminated last line
+const rotationSlack = 2
+
+// FileIdentity tells two generations of the same log path apart
+type FileIdentity struct {
+	Dev      uint64 `json:"dev"`
+	Ino      uint64 `json:"ino"`
+	HeadLen  int    `json:"head_len"`
+	HeadHash string `json:"head_hash"`
+}
+
+// rotatedSuffixGlobs cover numbered (app.log.1) and dated (app.log-20240101) rotation names
+var rotatedSuffixGlobs = []string{".*", "-*", "_*"}
+
+// Rotation is the kind of change detected between two scans of a path
+type Rotation int
+
+const (
+	RotationNone      Rotation = iota
+	RotationTruncated          // copytruncate, same inode shrunk below the last offset
+	RotationReplaced           // same inode rewritten in place, the head of the file changed
+	RotationRenamed            // rename rotation, a different inode now lives at the path
+)
+
+func (r Rotation) String() string {
+	switch r {
+	case RotationTruncated:
+		return "truncated"
+	case RotationReplaced:
+		return "replaced"
+	case RotationRenamed:
+		return "renamed"
+	default:
+		return "none"
+	}
+}
+
+// readHead returns up to fingerprintSize bytes from the start of the file without moving its offset
+func readHead(file *os.File) ([]byte, error) {
+	buf := make([]byte, fingerprintSize)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func headHash(head []byte) string {
+	h := sha256.Sum256(head)
+	return hex.EncodeToString(h[:8])
+}
+
+// NewFileIdentity builds the identity of an open file
+func NewFileIdentity(file *os.File, fileInfo os.FileInfo) (*FileIdentity, []byte, error) {
+	head, err := readHead(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	dev, ino := fileDevIno(fileInfo)
+	return &FileIdentity{
+		Dev:      dev,
+		Ino:      ino,
+		HeadLen:  len(head),
+		HeadHash: headHash(head),
+	}, head, nil
+}
+
+// SameFile reports whether both identities point at the same inode, unknown inodes always match
+func (id *FileIdentity) SameFile(other *FileIdentity) bool {
+	if id.Ino == 0 || other.Ino == 0 {
+		return true
+	}
+	return id.Dev == other.Dev && id.Ino == other.Ino
+}
+
+// DetectRotation compares the previous identity and offset with the current file
+// prev is nil for state saved before identities were tracked, then only the size is compared
+func DetectRotation(prev *FileIdentity, prevSize int64, cur *FileIdentity, head []byte, curSize int64) Rotation {
+	if prev == nil {
+		if curSize+rotationSlack < prevSize {
+			return RotationTruncated
+		}
+		return RotationNone
+	}
+	if !prev.SameFile(cur) {
+		return RotationRenamed
+	}
+	if curSize+rotationSlack < prevSize {
+		return RotationTruncated
+	}
+	if len(head) < prev.HeadLen || headHash(head[:prev.HeadLen]) != prev.HeadHash {
+		return RotationReplaced
+	}
+	return RotationNone
+}
+
+// FindRotatedFile looks next to filePath for the file that still has the previous inode
+func FindRotatedFile(filePath string, prev *FileIdentity) (string, error) {
+	if prev == nil || prev.Ino == 0 {
+		return "", nil
+	}
+	for _, suffix := range rotatedSuffixGlobs {
+		candidates, err := filepath.Glob(filePath + suffix)
+		if err != nil {
+			return "", err
+		}
+		for _, candidate := range candidates {
+			info, err := os.Stat(candidate)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			dev, ino := fileDevIno(info)
+			if dev == prev.Dev && ino == prev.Ino {
+				return candidate, nil
+			}
+		}
+	}
+	return "", nil
+}
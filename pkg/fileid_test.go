@@ -0,0 +1,233 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectRotation(t *testing.T) {
+	head := []byte("2024-01-01 app started\nline2\n")
+	prev := &FileIdentity{Dev: 1, Ino: 100, HeadLen: len(head), HeadHash: headHash(head)}
+
+	grown := append(append([]byte{}, head...), []byte("line3\n")...)
+	rewritten := []byte("2024-02-02 app started\nline2\nline3\n")
+
+	tests := []struct {
+		name     string
+		prev     *FileIdentity
+		prevSize int64
+		cur      *FileIdentity
+		head     []byte
+		curSize  int64
+		expected Rotation
+	}{
+		{
+			name:     "legacy state without identity, grown",
+			prev:     nil,
+			prevSize: 10,
+			cur:      &FileIdentity{Dev: 1, Ino: 100},
+			head:     head,
+			curSize:  30,
+			expected: RotationNone,
+		},
+		{
+			name:     "legacy state without identity, shrunk",
+			prev:     nil,
+			prevSize: 100,
+			cur:      &FileIdentity{Dev: 1, Ino: 100},
+			head:     head,
+			curSize:  30,
+			expected: RotationTruncated,
+		},
+		{
+			name:     "same file appended",
+			prev:     prev,
+			prevSize: int64(len(head)),
+			cur:      &FileIdentity{Dev: 1, Ino: 100},
+			head:     grown,
+			curSize:  int64(len(grown)),
+			expected: RotationNone,
+		},
+		{
+			name:     "copytruncate",
+			prev:     prev,
+			prevSize: 500,
+			cur:      &FileIdentity{Dev: 1, Ino: 100},
+			head:     head,
+			curSize:  int64(len(head)),
+			expected: RotationTruncated,
+		},
+		{
+			name:     "rewritten in place past the old offset",
+			prev:     prev,
+			prevSize: int64(len(head)),
+			cur:      &FileIdentity{Dev: 1, Ino: 100},
+			head:     rewritten,
+			curSize:  int64(len(rewritten)),
+			expected: RotationReplaced,
+		},
+		{
+			name:     "renamed and grown past the old offset",
+			prev:     prev,
+			prevSize: int64(len(head)),
+			cur:      &FileIdentity{Dev: 1, Ino: 200},
+			head:     grown,
+			curSize:  int64(len(grown)),
+			expected: RotationRenamed,
+		},
+		{
+			name:     "unknown inode falls back to fingerprint",
+			prev:     &FileIdentity{HeadLen: len(head), HeadHash: headHash(head)},
+			prevSize: int64(len(head)),
+			cur:      &FileIdentity{},
+			head:     rewritten,
+			curSize:  int64(len(rewritten)),
+			expected: RotationReplaced,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DetectRotation(tt.prev, tt.prevSize, tt.cur, tt.head, tt.curSize))
+		})
+	}
+}
+
+func TestScanRenameRotationGrownPastOffset(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are not available on windows")
+	}
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.WriteFile(filePath, []byte("line1\nerror:1\n"), 0600))
+
+	f := Flags{Match: "error:1"}
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+
+	watcher, err := NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	_, err = watcher.Scan(context.Background())
+	assert.NoError(t, err)
+
+	// rotate by rename, then the new file grows past the old offset before the next scan
+	assert.NoError(t, os.Rename(filePath, filePath+".1"))
+	assert.NoError(t, os.WriteFile(filePath, []byte("error:1\nerror:1\nline2\nline3\n"), 0600))
+
+	watcher, err = NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, RotationRenamed, result.Rotation)
+	assert.Equal(t, 2, result.ErrorCount)
+}
+
+func TestScanDrainsRotatedFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are not available on windows")
+	}
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.WriteFile(filePath, []byte("line1\n"), 0600))
+
+	f := Flags{Match: "error"}
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+
+	watcher, err := NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	_, err = watcher.Scan(context.Background())
+	assert.NoError(t, err)
+
+	// lines written after the last scan but before logrotate renamed the file
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = file.WriteString("error:before-rotation\n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	assert.NoError(t, os.Rename(filePath, filePath+"-20240101"))
+	assert.NoError(t, os.WriteFile(filePath, []byte("error:after-rotation\n"), 0600))
+
+	watcher, err = NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, RotationRenamed, result.Rotation)
+	assert.Equal(t, filePath+"-20240101", result.RotatedFile)
+	assert.Equal(t, 2, result.ErrorCount)
+	assert.Equal(t, "error:before-rotation", result.FirstLine)
+	assert.Equal(t, "error:after-rotation", result.LastLine)
+}
+
+func TestScanDrainCancelledIsRetried(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are not available on windows")
+	}
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.WriteFile(filePath, []byte("line1\n"), 0600))
+
+	f := Flags{Match: "error"}
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	watcher, err := NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	_, err = watcher.Scan(context.Background())
+	assert.NoError(t, err)
+
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = file.WriteString(strings.Repeat("error:before-rotation\n", ctxCheckLines))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, os.Rename(filePath, filePath+".1"))
+	assert.NoError(t, os.WriteFile(filePath, []byte("error:after-rotation\n"), 0600))
+
+	// a scan cut short while draining saves nothing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	watcher, err = NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	_, err = watcher.Scan(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	watcher, err = NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, filePath+".1", result.RotatedFile)
+	assert.Equal(t, ctxCheckLines+1, result.ErrorCount)
+}
+
+func TestFindRotatedFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are not available on windows")
+	}
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.WriteFile(filePath, []byte("old\n"), 0600))
+
+	file, err := os.Open(filePath)
+	assert.NoError(t, err)
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	prev, _, err := NewFileIdentity(file, info)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	assert.NoError(t, os.WriteFile(filePath+".2", []byte("older\n"), 0600))
+	assert.NoError(t, os.Rename(filePath, filePath+".1"))
+
+	found, err := FindRotatedFile(filePath, prev)
+	assert.NoError(t, err)
+	assert.Equal(t, filePath+".1", found)
+
+	found, err = FindRotatedFile(filePath, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
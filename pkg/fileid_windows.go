@@ -0,0 +1,10 @@
+//go:build windows
+
+package pkg
+
+import "os"
+
+// fileDevIno has no inode to offer on windows, rotation falls back to size and fingerprint
+func fileDevIno(_ os.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
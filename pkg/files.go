@@ -1,6 +1,8 @@
 package pkg
 
 import (
+	"errors"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -30,6 +32,24 @@ func IsTextFile(filename string) (bool, error) {
 		return false, err
 	}
 
+	// Compressed logs are text once decompressed, check what is inside instead
+	compression := DetectCompression(buffer[:n])
+	if compression == CompressionNone {
+		return utf8.Valid(buffer[:n]), nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	reader, err := NewDecompressReader(file, compression)
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+
+	n, err = io.ReadFull(reader, buffer)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
 	return utf8.Valid(buffer[:n]), nil
 }
 
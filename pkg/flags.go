@@ -4,44 +4,105 @@ import (
 	"flag"
 )
 
+// Flags hold the settings of one watch rule, the yaml tags are the keys a rule
+// in the --config file can override, "-" marks process wide settings
 type Flags struct {
-	FilePath       string
-	FilePathsCap   int
-	FileRecentSecs uint64
-	Match          string
-	Ignore         string
-	PostCommand    string
-	LogFile        string
+	Name           string        `yaml:"name"`
+	Config         string        `yaml:"-"`
+	FilePath       string        `yaml:"file-path"`
+	FilePathsCap   int           `yaml:"file-paths-cap"`
+	FileRecentSecs uint64        `yaml:"file-recent-secs"`
+	Match          string        `yaml:"match"`
+	NamedMatch     NamedPatterns `yaml:"named-match"`
+	Ignore         string        `yaml:"ignore"`
+	PostCommand    string        `yaml:"post-cmd"`
+	LogFile        string        `yaml:"-"`
+	StateDir       string        `yaml:"-"`
+	MinPercent     float64       `yaml:"min-percent"`
+	MinRate        float64       `yaml:"min-rate"`
 
-	Min                int
-	Streak             int
-	Every              uint64
-	Proxy              string
-	LogLevel           int
-	MemLimit           int
-	MSTeamsHook        string
-	GitURL             string
-	PagerDutyKey       string
-	PagerDutyDedupKey  string
-	MaxBufferMB        int
-	Severity           string
-	Test               bool
-	Version            bool
+	Min               int    `yaml:"min"`
+	Streak            int    `yaml:"streak"`
+	Every             uint64 `yaml:"-"`
+	Follow            bool   `yaml:"-"`
+	Digest            bool   `yaml:"-"`
+	FollowWindowMS    int    `yaml:"-"`
+	ShutdownSecs      uint64 `yaml:"-"`
+	Workers           int    `yaml:"-"`
+	ScanTimeoutSecs   uint64 `yaml:"-"`
+	Proxy             string `yaml:"-"`
+	LogLevel          int    `yaml:"-"`
+	MemLimit          int    `yaml:"-"`
+	MSTeamsHook       string `yaml:"ms-teams-hook"`
+	GitURL            string `yaml:"git-url"`
+	PagerDutyKey      string `yaml:"pagerduty-key"`
+	PagerDutyDedupKey string `yaml:"pagerduty-dedupkey"`
+	PagerDutyAck      bool   `yaml:"pagerduty-ack"`
+	ResolveAfter      int    `yaml:"resolve-after"`
+	CooldownSecs      uint64 `yaml:"cooldown-secs"`
+	RenotifySecs      uint64 `yaml:"renotify-secs"`
+	MaxBufferMB       int    `yaml:"mbf"`
+	MultilineStart    string `yaml:"multiline-start"`
+	MultilineContinue string `yaml:"multiline-continue"`
+	MultilineMaxBytes int    `yaml:"multiline-max-bytes"`
+	Format            string `yaml:"format"`
+	Where             string `yaml:"where"`
+	IgnoreWhere       string `yaml:"ignore-where"`
+	Fields            string `yaml:"fields"`
+	Top               int    `yaml:"top"`
+	StatusPercent     string `yaml:"status-percent"`
+	Latency           string `yaml:"latency"`
+	Absent            bool   `yaml:"absent"`
+	StaleSecs         uint64 `yaml:"stale-secs"`
+	MaxAgeSecs        uint64 `yaml:"max-age-secs"`
+	Severity          string `yaml:"severity"`
+	Test              bool   `yaml:"-"`
+	Version           bool   `yaml:"-"`
+
+	Escalate        bool    `yaml:"escalate"`
+	CriticalPercent float64 `yaml:"critical-percent"`
+	Anomaly         float64 `yaml:"anomaly"`
+	AnomalyHourly   bool    `yaml:"anomaly-hourly"`
 }
 
 func Parseflags(f *Flags) {
 	flag.StringVar(&f.FilePath, "file-path", "", "full path to the file to watch")
 	flag.StringVar(&f.FilePath, "f", "", "(short for --file-path) full path to the file to watch")
+	flag.StringVar(&f.Config, "config", "", "yaml file with named rules, each rule overrides the flags given on the command line")
+	flag.StringVar(&f.Name, "name", "", "name of the rule given by the flags, shown in notifications")
 	flag.StringVar(&f.LogFile, "log-file", "", "full path to output log file. Empty will log to stdout")
 	flag.StringVar(&f.Match, "match", ".*", "regex for matching errors (empty to match all lines)")
+	flag.Var(&f.NamedMatch, "named-match", "name=regex, counted separately in notifications, repeat for more. Replaces --match when given")
 	flag.StringVar(&f.Ignore, "ignore", "", "regex for ignoring errors (empty to ignore none)")
+	flag.StringVar(&f.MultilineStart, "multiline-start", "", "regex for the first line of an event, the lines after it are joined to it until the next match")
+	flag.StringVar(&f.MultilineContinue, "multiline-continue", "", `regex for lines joined to the event before them (e.g. '^\s|^Caused by:')`)
+	flag.IntVar(&f.MultilineMaxBytes, "multiline-max-bytes", 16384, "cut joined events at n bytes (0 for no limit)")
+	flag.StringVar(&f.Format, "format", "text", "line format, text, json, ltsv, combined, nginx-main or an nginx log_format string. Structured lines can be matched by field with --where")
+	flag.StringVar(&f.Where, "where", "", `with --format, field predicates a line must also pass (e.g. 'level in [error,fatal] && status >= 500')`)
+	flag.StringVar(&f.IgnoreWhere, "ignore-where", "", `with --format, field predicates for ignoring lines (e.g. 'msg contains "retrying"')`)
+	flag.StringVar(&f.Fields, "fields", "", "with --format, comma separated fields shown in notifications instead of the raw line, with counts of their values")
+	flag.IntVar(&f.Top, "top", 10, "number of most frequent values listed for --fields and named capture groups like (?P<endpoint>/api/\\S+) in --match (0 for all)")
+	flag.StringVar(&f.StatusPercent, "status-percent", "", "with an access log --format, a scan counts only when more than n percent of requests are in the status class (e.g. 5xx:2)")
+	flag.StringVar(&f.Latency, "latency", "", "with an access log --format, a scan counts only when the request time percentile is over n seconds (e.g. p95:1)")
+	flag.StringVar(&f.StateDir, "state-dir", "", "directory to persist offsets and streaks across restarts. Empty keeps state in memory only")
 	flag.StringVar(&f.PostCommand, "post-cmd", "", "run this shell command after every scan when min errors are found")
 	flag.Uint64Var(&f.Every, "every", 0, "run every n seconds (0 to run once)")
+	flag.BoolVar(&f.Follow, "follow", false, "scan files as soon as they are written to, using filesystem notifications")
+	flag.IntVar(&f.FollowWindowMS, "follow-window", 1000, "with --follow, coalesce events for n milliseconds into one scan")
+	flag.BoolVar(&f.Digest, "digest", false, "send the alerts of all files scanned together as one ms teams card and one pagerduty event, per notifier")
+	flag.IntVar(&f.Workers, "workers", 4, "number of files scanned in parallel")
+	flag.Uint64Var(&f.ScanTimeoutSecs, "scan-timeout-secs", 0, "give up scanning a file after n seconds, it is retried on the next run (0 to disable)")
+	flag.Uint64Var(&f.ShutdownSecs, "shutdown-secs", 30, "on SIGINT or SIGTERM, wait up to n seconds for the running scan and notifications")
 	flag.IntVar(&f.LogLevel, "log-level", 0, "log level (0=info, -4=debug, 4=warn, 8=error)")
 	flag.IntVar(&f.MemLimit, "mem-limit", 128, "memory limit in MB (0 to disable)")
 	flag.IntVar(&f.FilePathsCap, "file-paths-cap", 100, "max number of file paths to watch")
 	flag.Uint64Var(&f.FileRecentSecs, "file-recent-secs", 86400, "only files modified in the last n seconds, 0 to disable")
 	flag.IntVar(&f.Min, "min", 1, "on minimum num of matches, it should notify")
+	flag.Float64Var(&f.MinPercent, "min-percent", 0, "with --min, a scan counts only when at least n percent of the lines read match (0 to disable)")
+	flag.Float64Var(&f.MinRate, "min-rate", 0, "with --min, a scan counts only when at least n matches per second were written since the previous scan (0 to disable)")
+	flag.BoolVar(&f.Absent, "absent", false, "notify when fewer than --min lines match in --streak scans in a row, for heartbeats like 'job completed'. Needs --every")
+	flag.Uint64Var(&f.StaleSecs, "stale-secs", 0, "with --absent, also notify when the file was not modified for n seconds (0 to disable)")
+	flag.Uint64Var(&f.MaxAgeSecs, "max-age-secs", 0, "count only matches whose timestamp is at most n seconds old, older ones are reported as stale. Lines without a timestamp always count (0 to disable, e.g. --every plus some skew)")
 	flag.IntVar(&f.Streak, "streak", 1, "on minimum num of streak matches, it should notify")
 	flag.IntVar(&f.MaxBufferMB, "mbf", 0, "max buffer in MB, default is 0 (not provided) for go's default 64KB")
 	flag.BoolVar(&f.Version, "version", false, "")
@@ -56,8 +117,16 @@ go-watch-logs --file-path=./ssl_access.*log --test
 	flag.StringVar(&f.MSTeamsHook, "ms-teams-hook", "", "ms teams webhook")
 	flag.StringVar(&f.GitURL, "git-url", "", "git repo URL (e.g. github.com/org/repo) for MS Teams issue button")
 	flag.StringVar(&f.PagerDutyKey, "pagerduty-key", "", "pagerduty routing/integration key")
-	flag.StringVar(&f.PagerDutyDedupKey, "pagerduty-dedupkey", "", "pagerduty uniq key, for grpuping events")
+	flag.StringVar(&f.PagerDutyDedupKey, "pagerduty-dedupkey", "", "pagerduty dedup key template, one incident per distinct key. {hostname}, {file}, {glob}, {rule} and {severity} (not with --escalate) are replaced (empty for go-watch-logs:{hostname}:{rule}:{file})")
+	flag.BoolVar(&f.PagerDutyAck, "pagerduty-ack", false, "acknowledge the pagerduty incident on the first scan the alert condition is clear")
+	flag.IntVar(&f.ResolveAfter, "resolve-after", 0, "after n scans in a row without the alert condition, resolve the pagerduty incident and send a resolved card to ms teams (0 to never resolve)")
+	flag.Uint64Var(&f.CooldownSecs, "cooldown-secs", 0, "after a notification, hold back notifications of the same rule and file for n seconds (0 to notify on every scan)")
+	flag.Uint64Var(&f.RenotifySecs, "renotify-secs", 0, "while an alert keeps firing, remind every n seconds instead of every scan, longer than --cooldown-secs (0 for the cooldown only)")
 	flag.StringVar(&f.Severity, "severity", "error", "severity level for alerts (e.g. info, warning, error, critical)")
+	flag.BoolVar(&f.Escalate, "escalate", false, "instead of --severity, alert as warning when --streak is met, error after twice the streak and critical over --critical-percent. A higher severity notifies even within --cooldown-secs")
+	flag.Float64Var(&f.Anomaly, "anomaly", 0, "a scan counts only when its matches are at least n standard deviations over the moving baseline of the file (e.g. 3, 0 to disable)")
+	flag.BoolVar(&f.AnomalyHourly, "anomaly-hourly", false, "with --anomaly, learn a baseline per hour of the day for files busier at some hours")
+	flag.Float64Var(&f.CriticalPercent, "critical-percent", 0, "with --escalate, alert as critical when at least n percent of the lines read match (0 to disable)")
 
 	flag.Parse()
 	ParsePostFlags(f)
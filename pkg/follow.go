@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Follower wakes up on filesystem events for the files matching a pattern
+// and coalesces bursts of events into one callback per window
+type Follower struct {
+	watcher *fsnotify.Watcher
+	pattern string
+	isDir   bool
+	window  time.Duration
+}
+
+func NewFollower(pattern string, window time.Duration) (*Follower, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	fl := &Follower{
+		watcher: watcher,
+		pattern: pattern,
+		window:  window,
+	}
+
+	dirs, err := fl.dirsToWatch()
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		slog.Info("Following directory", "dir", dir)
+	}
+	return fl, nil
+}
+
+// dirsToWatch returns the directories that can hold files matching the pattern,
+// inotify watches directories so files created by rotation are seen too
+func (fl *Follower) dirsToWatch() ([]string, error) {
+	info, err := os.Stat(fl.pattern)
+	if err == nil && info.IsDir() {
+		fl.isDir = true
+		var dirs []string
+		err := filepath.Walk(fl.pattern, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+		return dirs, err
+	}
+
+	candidates, err := filepath.Glob(filepath.Dir(fl.pattern))
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			dirs = append(dirs, candidate)
+		}
+	}
+	return dirs, nil
+}
+
+func (fl *Follower) matches(filePath string) bool {
+	if fl.isDir {
+		return true
+	}
+	ok, err := filepath.Match(fl.pattern, filePath)
+	return err == nil && ok
+}
+
+// Run blocks until Close, onChange receives the sorted file paths that changed within a window
+func (fl *Follower) Run(onChange func(filePaths []string)) {
+	dirty := make(map[string]struct{})
+	var flush <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-fl.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if !fl.matches(event.Name) {
+				continue
+			}
+			slog.Debug("Follow event", "filePath", event.Name, "op", event.Op.String())
+			dirty[event.Name] = struct{}{}
+			if flush == nil {
+				flush = time.After(fl.window)
+			}
+		case err, ok := <-fl.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("Error following files", "error", err.Error())
+		case <-flush:
+			flush = nil
+			filePaths := make([]string, 0, len(dirty))
+			for filePath := range dirty {
+				filePaths = append(filePaths, filePath)
+			}
+			sort.Strings(filePaths)
+			dirty = make(map[string]struct{})
+			onChange(filePaths)
+		}
+	}
+}
+
+func (fl *Follower) Close() error {
+	return fl.watcher.Close()
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollowerCoalescesEvents(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.WriteFile(filePath, []byte("line1\n"), 0600))
+
+	follower, err := NewFollower(filepath.Join(dir, "*.log"), 100*time.Millisecond)
+	assert.NoError(t, err)
+
+	changes := make(chan []string, 10)
+	done := make(chan struct{})
+	go func() {
+		follower.Run(func(filePaths []string) {
+			changes <- filePaths
+		})
+		close(done)
+	}()
+
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = file.WriteString("error:1\n")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, file.Close())
+	// not matching the pattern
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "app.txt"), []byte("error:1\n"), 0600))
+
+	select {
+	case filePaths := <-changes:
+		assert.Equal(t, []string{filePath}, filePaths)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected a change notification")
+	}
+
+	select {
+	case filePaths := <-changes:
+		t.Fatalf("expected a single coalesced notification, got %v", filePaths)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	assert.NoError(t, follower.Close())
+	<-done
+}
+
+func TestFollowerMatches(t *testing.T) {
+	fl := &Follower{pattern: "/var/log/*.log"}
+	assert.True(t, fl.matches("/var/log/app.log"))
+	assert.False(t, fl.matches("/var/log/app.log.1"))
+
+	fl = &Follower{pattern: "/var/log", isDir: true}
+	assert.True(t, fl.matches("/var/log/app.log.1"))
+}
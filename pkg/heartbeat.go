@@ -0,0 +1,21 @@
+package pkg
+
+import (
+	"fmt"
+	"time"
+)
+
+// MissingHeartbeat returns why an --absent rule should notify, empty while the heartbeat is seen
+// The file going stale is checked first, a writer that died also stops every match
+func MissingHeartbeat(result *ScanResult, f Flags, now time.Time) string {
+	if f.StaleSecs > 0 {
+		age := now.Sub(result.FileInfo.ModTime())
+		if age > time.Duration(f.StaleSecs)*time.Second {
+			return fmt.Sprintf("file not modified for %s", age.Round(time.Second))
+		}
+	}
+	if StreakBelow(result.Streak, f.Streak, f.Min) {
+		return fmt.Sprintf("fewer than %d matches in each of the last %d scans", f.Min, f.Streak)
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func heartbeatResult(t *testing.T, modTime time.Time, streak []int) *ScanResult {
+	filePath := filepath.Join(t.TempDir(), "job.log")
+	assert.NoError(t, os.WriteFile(filePath, []byte("job completed\n"), 0600))
+	assert.NoError(t, os.Chtimes(filePath, modTime, modTime))
+	info, err := os.Stat(filePath)
+	assert.NoError(t, err)
+	return &ScanResult{FilePath: filePath, FileInfo: info, Streak: streak, ScanCount: len(streak) + 1}
+}
+
+func TestMissingHeartbeat(t *testing.T) {
+	now := time.Now()
+	f := Flags{Absent: true, Min: 1, Streak: 3}
+
+	tests := []struct {
+		name      string
+		modTime   time.Time
+		streak    []int
+		staleSecs uint64
+		expected  string
+	}{
+		{name: "seen", modTime: now, streak: []int{0, 0, 1}, expected: ""},
+		{name: "not enough scans yet", modTime: now, streak: []int{0, 0}, expected: ""},
+		{name: "missing", modTime: now, streak: []int{1, 0, 0, 0}, expected: "fewer than 1 matches in each of the last 3 scans"},
+		{name: "stale file", modTime: now.Add(-10 * time.Minute), streak: []int{1}, staleSecs: 300, expected: "file not modified for 10m0s"},
+		{name: "recent file", modTime: now.Add(-time.Minute), streak: []int{1}, staleSecs: 300, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.StaleSecs = tt.staleSecs
+			result := heartbeatResult(t, tt.modTime, tt.streak)
+			assert.Equal(t, tt.expected, MissingHeartbeat(result, f, now))
+		})
+	}
+}
+
+func TestNotifyMissingHeartbeat(t *testing.T) {
+	var card teamsCard
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &card)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	f := Flags{Absent: true, Min: 1, Streak: 2, MSTeamsHook: server.URL}
+	result := heartbeatResult(t, time.Now(), []int{0, 0})
+	NotifyMissingHeartbeat(context.Background(), result, f, "fewer than 1 matches in each of the last 2 scans", "test", testHTTPClient())
+
+	hostname, _ := os.Hostname()
+	content := card.Attachments[0].Content
+	title := content.Body[0].(map[string]any)["text"]
+	assert.Equal(t, "Missing heartbeat on "+hostname, title)
+	facts := content.Body[1].(map[string]any)["facts"].([]any)
+	assert.Equal(t, map[string]any{"title": "Missing Heartbeat", "value": "fewer than 1 matches in each of the last 2 scans"}, facts[0])
+}
@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -114,7 +115,28 @@ func actionButton(title string, details []Details, gitURL string) []teamsAction
 	}}
 }
 
-func sendToTeams(title string, details []Details, gitURL, hookURL string, httpClient *http.Client) error {
+// Accent colors of the Teams cards
+const (
+	teamsColorAlert    = "bf0000"
+	teamsColorResolved = "2e7d32"
+)
+
+// teamsSeverityColors are the accent colors of alerts by severity, others use teamsColorAlert
+var teamsSeverityColors = map[string]string{
+	"info":     "0078d4",
+	"warning":  "e3a21a",
+	"error":    teamsColorAlert,
+	"critical": "6b0000",
+}
+
+func teamsColor(severity string) string {
+	if color, ok := teamsSeverityColors[severity]; ok {
+		return color
+	}
+	return teamsColorAlert
+}
+
+func sendToTeams(ctx context.Context, title, color string, details []Details, gitURL, hookURL string, httpClient *http.Client) error {
 	facts := make([]teamsFact, len(details))
 	for i, d := range details {
 		facts[i] = teamsFact{Title: d.Label, Value: d.Message}
@@ -132,7 +154,7 @@ func sendToTeams(title string, details []Details, gitURL, hookURL string, httpCl
 					Schema:      "http://adaptivecards.io/schemas/adaptive-card.json",
 					Type:        "AdaptiveCard",
 					Version:     "1.4",
-					AccentColor: "bf0000",
+					AccentColor: color,
 					Body: []interface{}{
 						teamsTextBlock{
 							Type:   "TextBlock",
@@ -160,7 +182,7 @@ func sendToTeams(title string, details []Details, gitURL, hookURL string, httpCl
 		return err
 	}
 
-	req, err := http.NewRequest("POST", hookURL, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", hookURL, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return err
 	}
@@ -197,7 +219,7 @@ func NotifyOwnErrorToTeams(e error, r slog.Record, msTeamsHook string, httpClien
 		return true
 	})
 
-	err := sendToTeams(hostname, details, "", msTeamsHook, httpClient)
+	err := sendToTeams(context.Background(), hostname, teamsColorAlert, details, "", msTeamsHook, httpClient)
 	if err != nil {
 		// keep it warn to prevent infinite loop from the global handler of slog
 		slog.Warn("Error sending to Teams", "error", err.Error())
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -47,7 +48,7 @@ func TestSendToTeams_Success(t *testing.T) {
 		{Label: "Match", Message: "error"},
 	}
 
-	err := sendToTeams("Test Alert", details, "", server.URL, testHTTPClient())
+	err := sendToTeams(context.Background(), "Test Alert", teamsColorAlert, details, "", server.URL, testHTTPClient())
 	if err != nil {
 		t.Errorf("sendToTeams() unexpected error: %v", err)
 	}
@@ -66,7 +67,7 @@ func TestSendToTeams_RequestBody(t *testing.T) {
 		{Label: "Match", Message: "error"},
 	}
 
-	err := sendToTeams("Test Alert", details, "", server.URL, testHTTPClient())
+	err := sendToTeams(context.Background(), "Test Alert", teamsColorAlert, details, "", server.URL, testHTTPClient())
 	if err != nil {
 		t.Fatalf("sendToTeams() unexpected error: %v", err)
 	}
@@ -96,7 +97,7 @@ func TestSendToTeams_ContentTypeHeader(t *testing.T) {
 	}))
 	defer server.Close()
 
-	_ = sendToTeams("title", []Details{{Label: "k", Message: "v"}}, "", server.URL, testHTTPClient())
+	_ = sendToTeams(context.Background(), "title", teamsColorAlert, []Details{{Label: "k", Message: "v"}}, "", server.URL, testHTTPClient())
 }
 
 func TestSendToTeams_WithGitURL(t *testing.T) {
@@ -114,7 +115,7 @@ func TestSendToTeams_WithGitURL(t *testing.T) {
 		{Label: "Lines", Message: "line1\nline2"},
 	}
 
-	err := sendToTeams("Alert", details, "github.com/org/repo", server.URL, testHTTPClient())
+	err := sendToTeams(context.Background(), "Alert", teamsColorAlert, details, "github.com/org/repo", server.URL, testHTTPClient())
 	if err != nil {
 		t.Fatalf("sendToTeams() unexpected error: %v", err)
 	}
@@ -147,7 +148,7 @@ func TestSendToTeams_WithoutGitURL_NoActions(t *testing.T) {
 	}))
 	defer server.Close()
 
-	err := sendToTeams("Alert", []Details{{Label: "k", Message: "v"}}, "", server.URL, testHTTPClient())
+	err := sendToTeams(context.Background(), "Alert", teamsColorAlert, []Details{{Label: "k", Message: "v"}}, "", server.URL, testHTTPClient())
 	if err != nil {
 		t.Fatalf("sendToTeams() unexpected error: %v", err)
 	}
@@ -176,7 +177,7 @@ func TestSendToTeams_FactsMatchDetails(t *testing.T) {
 		{Label: "Match", Message: "panic"},
 	}
 
-	_ = sendToTeams("Alert", details, "", server.URL, testHTTPClient())
+	_ = sendToTeams(context.Background(), "Alert", teamsColorAlert, details, "", server.URL, testHTTPClient())
 
 	var card teamsCard
 	_ = json.Unmarshal(capturedBody, &card)
@@ -199,7 +200,7 @@ func TestSendToTeams_FactsMatchDetails(t *testing.T) {
 }
 
 func TestSendToTeams_InvalidHookURL(t *testing.T) {
-	err := sendToTeams("title", []Details{}, "", "://bad-url", testHTTPClient())
+	err := sendToTeams(context.Background(), "title", teamsColorAlert, []Details{}, "", "://bad-url", testHTTPClient())
 	if err == nil {
 		t.Error("expected error for invalid hook URL, got nil")
 	}
@@ -218,7 +219,7 @@ func TestSendToTeams_ServerError(t *testing.T) {
 	}))
 	defer server.Close()
 
-	err := sendToTeams("title", []Details{}, "", server.URL, testHTTPClient())
+	err := sendToTeams(context.Background(), "title", teamsColorAlert, []Details{}, "", server.URL, testHTTPClient())
 	if err == nil {
 		t.Error("expected error when server closes connection, got nil")
 	}
@@ -239,3 +240,15 @@ func TestNotifyOwnErrorToTeams_BadHook(_ *testing.T) {
 	var rec slog.Record
 	NotifyOwnErrorToTeams(errors.New("test error"), rec, "://bad-url", testHTTPClient())
 }
+
+func TestTeamsColor(t *testing.T) {
+	if got := teamsColor("error"); got != "bf0000" {
+		t.Errorf("teamsColor(error) = %q, want %q", got, "bf0000")
+	}
+	if got := teamsColor("warning"); got == teamsColorAlert {
+		t.Errorf("teamsColor(warning) = %q, want a color apart from errors", got)
+	}
+	if got := teamsColor("unknown"); got != teamsColorAlert {
+		t.Errorf("teamsColor(unknown) = %q, want %q", got, teamsColorAlert)
+	}
+}
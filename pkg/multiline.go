@@ -0,0 +1,85 @@
+package pkg
+
+import (
+	"regexp"
+)
+
+// Multiline decides which lines belong together as one event, such as a stack trace
+type Multiline struct {
+	start    *regexp.Regexp // a matching line begins a new event
+	cont     *regexp.Regexp // a matching line belongs to the previous event
+	maxBytes int            // events are cut at this size, the rest of their lines are dropped
+}
+
+// NewMultiline returns nil when neither pattern is given, lines are then events on their own
+func NewMultiline(start, cont string, maxBytes int) (*Multiline, error) {
+	if start == "" && cont == "" {
+		return nil, nil
+	}
+	m := &Multiline{maxBytes: maxBytes}
+	var err error
+	if start != "" {
+		if m.start, err = regexp.Compile(start); err != nil {
+			return nil, err
+		}
+	}
+	if cont != "" {
+		if m.cont, err = regexp.Compile(cont); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// continues reports whether the line is part of the event before it
+func (m *Multiline) continues(line []byte) bool {
+	if m.cont != nil && m.cont.Match(line) {
+		return true
+	}
+	return m.start != nil && !m.start.Match(line)
+}
+
+// eventJoiner collects the lines of one scan into events
+type eventJoiner struct {
+	m       *Multiline
+	event   []byte
+	pending bool
+	start   int64 // offset of the first line of the pending event
+	before  int   // lines read before the pending event
+}
+
+func (m *Multiline) joiner() *eventJoiner {
+	return &eventJoiner{m: m}
+}
+
+// add returns the previous event once line begins a new one, offset and before
+// locate the line in the scan. The scanner reuses its buffer, so the line is always copied
+func (j *eventJoiner) add(line []byte, offset int64, before int) ([]byte, bool) {
+	if j.pending && j.m.continues(line) {
+		if j.m.maxBytes <= 0 || len(j.event)+1+len(line) <= j.m.maxBytes {
+			j.event = append(append(j.event, '\n'), line...)
+		}
+		return nil, false
+	}
+
+	event, ok := j.flush()
+	j.event = append([]byte(nil), line...)
+	if j.m.maxBytes > 0 && len(j.event) > j.m.maxBytes {
+		j.event = j.event[:j.m.maxBytes]
+	}
+	j.pending = true
+	j.start = offset
+	j.before = before
+	return event, ok
+}
+
+// flush returns the event still being collected
+func (j *eventJoiner) flush() ([]byte, bool) {
+	if !j.pending {
+		return nil, false
+	}
+	event := j.event
+	j.event = nil
+	j.pending = false
+	return event, true
+}
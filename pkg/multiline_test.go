@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func joinAll(m *Multiline, lines ...string) []string {
+	events := []string{}
+	j := m.joiner()
+	for i, line := range lines {
+		if event, ok := j.add([]byte(line), 0, i); ok {
+			events = append(events, string(event))
+		}
+	}
+	if event, ok := j.flush(); ok {
+		events = append(events, string(event))
+	}
+	return events
+}
+
+func TestMultiline(t *testing.T) {
+	trace := []string{
+		"2024-01-01 10:00:00 ERROR boom",
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.Foo.bar(Foo.java:10)",
+		"Caused by: java.io.IOException: closed",
+		"2024-01-01 10:00:01 INFO ok",
+	}
+
+	tests := []struct {
+		name     string
+		start    string
+		cont     string
+		maxBytes int
+		lines    []string
+		expected []string
+	}{
+		{
+			name:  "start pattern",
+			start: `^\d{4}-\d{2}-\d{2} `,
+			lines: trace,
+			expected: []string{
+				"2024-01-01 10:00:00 ERROR boom\njava.lang.IllegalStateException: boom\n\tat com.example.Foo.bar(Foo.java:10)\nCaused by: java.io.IOException: closed",
+				"2024-01-01 10:00:01 INFO ok",
+			},
+		},
+		{
+			name:  "continuation pattern",
+			cont:  `^\s|^Caused by:`,
+			lines: trace,
+			expected: []string{
+				"2024-01-01 10:00:00 ERROR boom",
+				"java.lang.IllegalStateException: boom\n\tat com.example.Foo.bar(Foo.java:10)\nCaused by: java.io.IOException: closed",
+				"2024-01-01 10:00:01 INFO ok",
+			},
+		},
+		{
+			name:     "capped",
+			start:    `^\d{4}-\d{2}-\d{2} `,
+			maxBytes: 40,
+			lines:    trace,
+			expected: []string{
+				"2024-01-01 10:00:00 ERROR boom",
+				"2024-01-01 10:00:01 INFO ok",
+			},
+		},
+		{
+			name:     "continuation lines before any start",
+			start:    `^\d{4}-\d{2}-\d{2} `,
+			lines:    []string{"\tat a", "\tat b", "2024-01-01 10:00:00 ERROR boom"},
+			expected: []string{"\tat a\n\tat b", "2024-01-01 10:00:00 ERROR boom"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMultiline(tt.start, tt.cont, tt.maxBytes)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, joinAll(m, tt.lines...))
+		})
+	}
+}
+
+func TestNewMultiline(t *testing.T) {
+	m, err := NewMultiline("", "", 100)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	_, err = NewMultiline("(", "", 100)
+	assert.Error(t, err)
+	_, err = NewMultiline("", "(", 100)
+	assert.Error(t, err)
+}
@@ -1,13 +1,46 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 	"time"
 )
 
+// defaultDedupKey opens one PagerDuty incident per host, rule and file
+const defaultDedupKey = "go-watch-logs:{hostname}:{rule}:{file}"
+
+// dedupKeyMax is the longest dedup key PagerDuty accepts
+const dedupKeyMax = 255
+
+// DedupKey expands the --pagerduty-dedupkey template of the rule for a scanned file
+func DedupKey(f Flags, hostname, filePath, severity string) string {
+	template := f.PagerDutyDedupKey
+	if template == "" {
+		template = defaultDedupKey
+	}
+	return expandDedupKey(template, f, hostname, filePath, severity)
+}
+
+func expandDedupKey(template string, f Flags, hostname, filePath, severity string) string {
+	key := strings.NewReplacer(
+		"{hostname}", hostname,
+		"{file}", filePath,
+		"{glob}", f.FilePath,
+		"{rule}", f.Name,
+		"{severity}", severity,
+	).Replace(template)
+	if len(key) > dedupKeyMax {
+		// keep long keys apart by a hash of the part cut off
+		key = key[:dedupKeyMax-7] + "-" + Hash(key)
+	}
+	return key
+}
+
 func NotifyOwnErrorToPagerDuty(e error, r slog.Record, pagerDutyKey string, httpClient *http.Client) {
 	hostname, _ := os.Hostname()
 	slog.Info("Sending own error to PagerDuty")
@@ -22,7 +55,7 @@ func NotifyOwnErrorToPagerDuty(e error, r slog.Record, pagerDutyKey string, http
 	})
 	pd := NewPagerDuty()
 
-	status, err := pd.Send(hostname, details, pagerDutyKey, "error", "", httpClient)
+	status, err := pd.Send(context.Background(), hostname, details, pagerDutyKey, "error", "", httpClient)
 	if err != nil {
 		slog.Warn("Error sending to PagerDuty", "error", err.Error())
 		return
@@ -30,8 +63,90 @@ func NotifyOwnErrorToPagerDuty(e error, r slog.Record, pagerDutyKey string, http
 	slog.Info("Successfully sent own error to PagerDuty", "status", status)
 }
 
-func Notify(result *ScanResult, f Flags, version string, httpClient *http.Client) {
+func Notify(ctx context.Context, result *ScanResult, f Flags, version string, httpClient *http.Client) {
+	hostname, _ := os.Hostname()
+	send(ctx, AlertTrigger, hostname, scanDetails(result, f, version), result, f, httpClient)
+}
+
+// NotifyMissingHeartbeat alerts an --absent rule, the card is titled apart from matched errors
+func NotifyMissingHeartbeat(ctx context.Context, result *ScanResult, f Flags, reason, version string, httpClient *http.Client) {
 	hostname, _ := os.Hostname()
+	details := append([]Details{{
+		Label:   "Missing Heartbeat",
+		Message: reason,
+	}}, scanDetails(result, f, version)...)
+	send(ctx, AlertTrigger, "Missing heartbeat on "+hostname, details, result, f, httpClient)
+}
+
+// NotifyAcknowledged acknowledges the PagerDuty incident once the alert condition starts to clear
+func NotifyAcknowledged(ctx context.Context, result *ScanResult, f Flags, version string, httpClient *http.Client) {
+	hostname, _ := os.Hostname()
+	send(ctx, AlertAcknowledge, "Clearing on "+hostname, resolvedDetails(result, f, version, "alert condition clear in the last scan"), result, f, httpClient)
+}
+
+// NotifyResolved resolves the PagerDuty incident and posts a green card once the alert condition stayed clear
+func NotifyResolved(ctx context.Context, result *ScanResult, f Flags, version string, httpClient *http.Client) {
+	hostname, _ := os.Hostname()
+	send(ctx, AlertResolve, "Resolved on "+hostname, resolvedDetails(result, f, version, fmt.Sprintf("alert condition clear for %d scans", f.ResolveAfter)), result, f, httpClient)
+}
+
+// NotifyClosed resolves the incident of a firing alert whose rule was changed or removed on reload
+func NotifyClosed(ctx context.Context, filePath string, alert *Alert, f Flags, version string, httpClient *http.Client) {
+	hostname, _ := os.Hostname()
+	result := &ScanResult{FilePath: filePath, Severity: alert.Severity}
+	send(ctx, AlertResolve, "Resolved on "+hostname, resolvedDetails(result, f, version, "rule changed or removed on reload"), result, f, httpClient)
+}
+
+// SameIncident checks whether the alerts of both rules on the file go to the same notifiers and PagerDuty incident
+func SameIncident(a, b Flags, filePath, severity string) bool {
+	hostname, _ := os.Hostname()
+	return a.MSTeamsHook == b.MSTeamsHook && a.PagerDutyKey == b.PagerDutyKey &&
+		DedupKey(a, hostname, filePath, severity) == DedupKey(b, hostname, filePath, severity)
+}
+
+// resolvedDetails are the facts of a clearing alert, the matched lines are gone by then
+func resolvedDetails(result *ScanResult, f Flags, version, status string) []Details {
+	match := f.Match
+	if f.NamedMatch != "" {
+		match = f.NamedMatch.String()
+	}
+	details := []Details{
+		{
+			Label:   "go-watch-log version",
+			Message: version,
+		},
+		{
+			Label:   "File",
+			Message: result.FilePath,
+		},
+		{
+			Label:   "Match",
+			Message: match,
+		},
+		{
+			Label:   "Status",
+			Message: status,
+		},
+		{
+			Label:   "Streaks",
+			Message: StreakSymbols(result.Streak, f.Streak, f.Min),
+		},
+	}
+	if f.Name != "" {
+		details = append(details, Details{
+			Label:   "Rule",
+			Message: f.Name,
+		})
+	}
+	return details
+}
+
+// scanDetails lists the facts of a scan shown in Teams and sent as PagerDuty custom details
+func scanDetails(result *ScanResult, f Flags, version string) []Details {
+	match := f.Match
+	if f.NamedMatch != "" {
+		match = f.NamedMatch.String()
+	}
 
 	details := []Details{
 		{
@@ -48,7 +163,7 @@ func Notify(result *ScanResult, f Flags, version string, httpClient *http.Client
 		},
 		{
 			Label:   "Match",
-			Message: f.Match,
+			Message: match,
 		},
 		{
 			Label:   "Ignore",
@@ -66,8 +181,10 @@ func Notify(result *ScanResult, f Flags, version string, httpClient *http.Client
 		{
 			Label: "Settings",
 			Message: fmt.Sprintf(
-				"min (%d), every (%d secs), max streak (%d)",
+				"min (%d), min percent (%g), min rate (%g/sec), every (%d secs), max streak (%d)",
 				f.Min,
+				f.MinPercent,
+				f.MinRate,
 				f.Every,
 				f.Streak,
 			),
@@ -75,10 +192,11 @@ func Notify(result *ScanResult, f Flags, version string, httpClient *http.Client
 		{
 			Label: "Scan Details",
 			Message: fmt.Sprintf(
-				"lines read (%s), %.2f%% errors (%s), scans til date (%s)",
+				"lines read (%s), %.2f%% errors (%s), %.2f errors/sec, scans til date (%s)",
 				NumberToK(result.LinesRead),
 				result.ErrorPercent,
 				NumberToK(result.ErrorCount),
+				result.ErrorRate,
 				NumberToK(result.ScanCount),
 			),
 		},
@@ -92,6 +210,90 @@ func Notify(result *ScanResult, f Flags, version string, httpClient *http.Client
 		},
 	}
 
+	if f.Name != "" {
+		details = append(details, Details{
+			Label:   "Rule",
+			Message: f.Name,
+		})
+	}
+
+	if result.Anomaly != nil {
+		details = append(details, Details{
+			Label:   "Anomaly",
+			Message: result.Anomaly.String(),
+		})
+	}
+
+	if result.Suppressed > 0 {
+		details = append(details, Details{
+			Label:   "Suppressed",
+			Message: fmt.Sprintf("suppressed %d alerts since last notification", result.Suppressed),
+		})
+	}
+
+	if result.StaleCount > 0 {
+		details = append(details, Details{
+			Label:   "Stale Lines",
+			Message: fmt.Sprintf("%s matches older than %d secs were not counted", NumberToK(result.StaleCount), f.MaxAgeSecs),
+		})
+	}
+
+	if f.Where != "" {
+		details = append(details, Details{
+			Label:   "Where",
+			Message: f.Where,
+		})
+	}
+
+	if result.Access != nil {
+		requests, latency := result.Access.Summary()
+		details = append(details, Details{
+			Label:   "Requests",
+			Message: requests,
+		})
+		if latency != "" {
+			details = append(details, Details{
+				Label:   "Request Time",
+				Message: latency,
+			})
+		}
+	}
+
+	if len(result.Exceeded) > 0 {
+		details = append(details, Details{
+			Label:   "Exceeded",
+			Message: strings.Join(result.Exceeded, ", "),
+		})
+	}
+
+	for _, field := range SplitFields(f.Fields) {
+		if counts, ok := result.FieldCounts[field]; ok {
+			details = append(details, Details{
+				Label:   field,
+				Message: TopCounts(counts, f.Top),
+			})
+		}
+	}
+
+	captures := make([]string, 0, len(result.CaptureCounts))
+	for name := range result.CaptureCounts {
+		captures = append(captures, name)
+	}
+	sort.Strings(captures)
+	for _, name := range captures {
+		details = append(details, Details{
+			Label:   name,
+			Message: TopCounts(result.CaptureCounts[name], f.Top),
+		})
+	}
+
+	if f.NamedMatch != "" {
+		details = append(details, Details{
+			Label:   "Match Counts",
+			Message: OrderedAsc(result.MatchCounts),
+		})
+	}
+
 	if result.FirstDate != "" || result.LastDate != "" {
 		var duration string
 		if result.FirstDate != "" && result.LastDate != "" {
@@ -114,6 +316,11 @@ func Notify(result *ScanResult, f Flags, version string, httpClient *http.Client
 		})
 	}
 
+	return details
+}
+
+// send delivers the details to every configured notifier, an acknowledge is for PagerDuty only
+func send(ctx context.Context, action AlertAction, title string, details []Details, result *ScanResult, f Flags, httpClient *http.Client) {
 	var logDetails []any // nolint: prealloc
 	for _, detail := range details {
 		logDetails = append(logDetails, detail.Label, detail.Message)
@@ -121,9 +328,13 @@ func Notify(result *ScanResult, f Flags, version string, httpClient *http.Client
 	slog.Debug("Sending Alert Notify", logDetails...)
 
 	// Send to MS Teams
-	if f.MSTeamsHook != "" {
-		slog.Info("Sending scan results to MS Teams")
-		err := sendToTeams(hostname, details, f.GitURL, f.MSTeamsHook, httpClient)
+	if f.MSTeamsHook != "" && action != AlertAcknowledge {
+		color := teamsColor(result.Severity)
+		if action == AlertResolve {
+			color = teamsColorResolved
+		}
+		slog.Info("Sending scan results to MS Teams", "action", action)
+		err := sendToTeams(ctx, title, color, details, f.GitURL, f.MSTeamsHook, httpClient)
 		if err != nil {
 			// keep it warn to prevent infinite loop from the global handler of slog
 			slog.Warn("Error sending to Teams", "error", err.Error())
@@ -133,17 +344,25 @@ func Notify(result *ScanResult, f Flags, version string, httpClient *http.Client
 	}
 
 	// Send to PagerDuty
-	if f.PagerDutyKey != "" && f.PagerDutyDedupKey != "" {
-		slog.Info("Sending scan results to PagerDuty")
+	if f.PagerDutyKey != "" {
+		hostname, _ := os.Hostname()
+		dedupKey := DedupKey(f, hostname, result.FilePath, result.Severity)
+		slog.Info("Sending scan results to PagerDuty", "action", action, "dedupKey", dedupKey)
 
 		// Convert Details to interface map for PagerDuty
 		pdetails := make(map[string]any)
 		for _, d := range details {
 			pdetails[d.Label] = d.Message
 		}
+		if len(result.FieldCounts) > 0 {
+			pdetails["Field Counts"] = result.FieldCounts
+		}
+		if len(result.CaptureCounts) > 0 {
+			pdetails["Capture Counts"] = result.CaptureCounts
+		}
 
 		pd := NewPagerDuty()
-		status, err := pd.Send(hostname, pdetails, f.PagerDutyKey, result.Severity, f.PagerDutyDedupKey, httpClient)
+		status, err := pd.SendEvent(ctx, action, title, pdetails, f.PagerDutyKey, result.Severity, dedupKey, httpClient)
 		if err != nil {
 			slog.Warn("Error sending to PagerDuty", "error", err.Error())
 		} else {
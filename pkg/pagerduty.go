@@ -16,10 +16,15 @@ func NewPagerDuty() *PagerDuty {
 }
 
 // SendWithOptions sends an event to PagerDuty with additional options
-func (pd *PagerDuty) Send(summary string, details map[string]any, routingKey string, severity string, dedupKey string, httpClient *http.Client) (string, error) {
+func (pd *PagerDuty) Send(ctx context.Context, summary string, details map[string]any, routingKey string, severity string, dedupKey string, httpClient *http.Client) (string, error) {
+	return pd.SendEvent(ctx, AlertTrigger, summary, details, routingKey, severity, dedupKey, httpClient)
+}
+
+// SendEvent sends a trigger, acknowledge or resolve, the last two act on the incident opened with the same dedupKey
+func (pd *PagerDuty) SendEvent(ctx context.Context, action AlertAction, summary string, details map[string]any, routingKey string, severity string, dedupKey string, httpClient *http.Client) (string, error) {
 	event := &eventsapi.EventV2{
 		RoutingKey:  routingKey,
-		EventAction: "trigger",
+		EventAction: string(action),
 		DedupKey:    dedupKey,
 		Payload: eventsapi.PayloadV2{
 			Summary:       summary,
@@ -29,7 +34,7 @@ func (pd *PagerDuty) Send(summary string, details map[string]any, routingKey str
 		},
 	}
 
-	resp, err := eventsapi.EnqueueV2(context.Background(), httpClient, event)
+	resp, err := eventsapi.EnqueueV2(ctx, httpClient, event)
 	if err != nil {
 		return "", err
 	}
@@ -2,8 +2,10 @@ package pkg
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -113,6 +115,7 @@ func TestPagerDuty_Send_Success(t *testing.T) {
 			mockClient := createMockHTTPClient(tt.statusCode, tt.body, nil)
 
 			status, err := pd.Send(
+				context.Background(),
 				tt.summary,
 				tt.details,
 				tt.routingKey,
@@ -146,6 +149,7 @@ func TestPagerDuty_Send_WithComplexDetails(t *testing.T) {
 	}
 
 	status, err := pd.Send(
+		context.Background(),
 		"Complex Details Test",
 		details,
 		"test-key",
@@ -168,6 +172,7 @@ func TestPagerDuty_Send_WithNilDetails(t *testing.T) {
 	mockClient := createMockHTTPClient(202, `{"status":"success"}`, nil)
 
 	status, err := pd.Send(
+		context.Background(),
 		"Nil Details Test",
 		nil,
 		"test-key",
@@ -190,6 +195,7 @@ func TestPagerDuty_Send_WithEmptyStrings(t *testing.T) {
 	mockClient := createMockHTTPClient(202, `{"status":"success"}`, nil)
 
 	status, err := pd.Send(
+		context.Background(),
 		"",
 		map[string]any{},
 		"test-key",
@@ -216,6 +222,7 @@ func TestPagerDuty_Send_DifferentSeverities(t *testing.T) {
 			mockClient := createMockHTTPClient(202, `{"status":"success"}`, nil)
 
 			status, err := pd.Send(
+				context.Background(),
 				"Severity Test",
 				map[string]any{"severity_test": severity},
 				"test-key",
@@ -243,6 +250,7 @@ func BenchmarkPagerDuty_Send_Simple(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = pd.Send(
+			context.Background(),
 			"Benchmark Test",
 			map[string]any{"iteration": i},
 			"bench-key",
@@ -270,6 +278,7 @@ func BenchmarkPagerDuty_Send_ComplexDetails(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = pd.Send(
+			context.Background(),
 			"Benchmark Complex Test",
 			details,
 			"bench-key",
@@ -287,6 +296,7 @@ func BenchmarkPagerDuty_Send_MinimalData(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = pd.Send(
+			context.Background(),
 			"Minimal",
 			nil,
 			"key",
@@ -310,6 +320,7 @@ func BenchmarkPagerDuty_Send_LargeSummary(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = pd.Send(
+			context.Background(),
 			summary,
 			map[string]any{"test": "data"},
 			"bench-key",
@@ -333,6 +344,7 @@ func BenchmarkPagerDuty_Send_ManyDetails(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = pd.Send(
+			context.Background(),
 			"Many Details Test",
 			details,
 			"bench-key",
@@ -360,6 +372,7 @@ func BenchmarkPagerDuty_Send_Parallel(b *testing.B) {
 		i := 0
 		for pb.Next() {
 			_, _ = pd.Send(
+				context.Background(),
 				"Parallel Benchmark Test",
 				map[string]any{"iteration": i},
 				"bench-key",
@@ -389,6 +402,7 @@ func BenchmarkPagerDuty_Send_ParallelComplex(b *testing.B) {
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
 			_, _ = pd.Send(
+				context.Background(),
 				"Parallel Complex Benchmark",
 				details,
 				"bench-key",
@@ -399,3 +413,34 @@ func BenchmarkPagerDuty_Send_ParallelComplex(b *testing.B) {
 		}
 	})
 }
+
+func TestDedupKey(t *testing.T) {
+	f := Flags{Name: "oom", FilePath: "/var/log/app/*.log"}
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"default", "", "go-watch-logs:web1:oom:/var/log/app/a.log"},
+		{"literal", "uniq-name", "uniq-name"},
+		{"template", "{hostname}/{glob}/{severity}", "web1//var/log/app/*.log/critical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.PagerDutyDedupKey = tt.template
+			if got := DedupKey(f, "web1", "/var/log/app/a.log", "critical"); got != tt.want {
+				t.Errorf("DedupKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	f.PagerDutyDedupKey = "{file}"
+	long := "/" + strings.Repeat("a", 300)
+	key := DedupKey(f, "web1", long, "error")
+	if len(key) != dedupKeyMax {
+		t.Errorf("len(DedupKey()) = %d, want %d", len(key), dedupKeyMax)
+	}
+	if other := DedupKey(f, "web1", long+"b", "error"); other == key {
+		t.Errorf("DedupKey() of different long paths are both %q", key)
+	}
+}
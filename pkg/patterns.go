@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NamedPatterns holds name=regex pairs one per line, a string keeps Flags comparable
+type NamedPatterns string
+
+// NamedPattern is one compiled entry of NamedPatterns
+type NamedPattern struct {
+	Name  string
+	Regex *regexp.Regexp
+}
+
+// String is shown in --help and notifications
+func (p *NamedPatterns) String() string {
+	return strings.ReplaceAll(string(*p), "\n", "; ")
+}
+
+// Set appends one name=regex pair, the flag can be repeated
+func (p *NamedPatterns) Set(value string) error {
+	name, pattern, ok := strings.Cut(value, "=")
+	if !ok || name == "" || pattern == "" {
+		return fmt.Errorf("%q is not name=regex", value)
+	}
+	if *p != "" {
+		*p += "\n"
+	}
+	*p += NamedPatterns(name + "=" + pattern)
+	return nil
+}
+
+// UnmarshalYAML reads a mapping of name: regex, keeping the order of the file
+func (p *NamedPatterns) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return errors.New("named-match must be a mapping of name: regex")
+	}
+	*p = ""
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if err := p.Set(node.Content[i].Value + "=" + node.Content[i+1].Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compile returns the patterns in the order they were given
+func (p NamedPatterns) Compile() ([]NamedPattern, error) {
+	if p == "" {
+		return nil, nil
+	}
+	lines := strings.Split(string(p), "\n")
+	patterns := make([]NamedPattern, 0, len(lines))
+	names := make(map[string]struct{}, len(lines))
+	for _, line := range lines {
+		name, pattern, _ := strings.Cut(line, "=")
+		if _, ok := names[name]; ok {
+			return nil, fmt.Errorf("duplicate name %q", name)
+		}
+		names[name] = struct{}{}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		patterns = append(patterns, NamedPattern{Name: name, Regex: re})
+	}
+	return patterns, nil
+}
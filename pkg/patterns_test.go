@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNamedPatterns_Set(t *testing.T) {
+	var p NamedPatterns
+	assert.NoError(t, p.Set("oom=OutOfMemory"))
+	assert.NoError(t, p.Set("db=Connection reset|level=fatal"))
+	assert.Equal(t, NamedPatterns("oom=OutOfMemory\ndb=Connection reset|level=fatal"), p)
+	assert.Equal(t, "oom=OutOfMemory; db=Connection reset|level=fatal", p.String())
+
+	for _, value := range []string{"OutOfMemory", "=OutOfMemory", "oom="} {
+		assert.Error(t, p.Set(value), value)
+	}
+}
+
+func TestNamedPatterns_UnmarshalYAML(t *testing.T) {
+	var rule struct {
+		NamedMatch NamedPatterns `yaml:"named-match"`
+	}
+	err := yaml.Unmarshal([]byte("named-match:\n  oom: OutOfMemory\n  db: Connection reset\n"), &rule)
+	assert.NoError(t, err)
+	assert.Equal(t, NamedPatterns("oom=OutOfMemory\ndb=Connection reset"), rule.NamedMatch)
+
+	err = yaml.Unmarshal([]byte("named-match: oom=OutOfMemory\n"), &rule)
+	assert.Error(t, err)
+}
+
+func TestNamedPatterns_Compile(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns NamedPatterns
+		names    []string
+		wantErr  bool
+	}{
+		{name: "empty", patterns: ""},
+		{name: "ordered", patterns: "oom=OutOfMemory\ndb=Connection (reset|refused)", names: []string{"oom", "db"}},
+		{name: "bad regex", patterns: "oom=(OutOfMemory", wantErr: true},
+		{name: "duplicate name", patterns: "oom=OutOfMemory\noom=OOM", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := tt.patterns.Compile()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			names := []string{}
+			for _, p := range compiled {
+				names = append(names, p.Name)
+			}
+			assert.ElementsMatch(t, tt.names, names)
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package pkg
+
+import "sync"
+
+// ForEachBounded calls fn for every index in [0, n) on at most workers goroutines and waits for all of them
+func ForEachBounded(n int, workers int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
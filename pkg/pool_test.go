@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachBounded(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		workers int
+	}{
+		{name: "more jobs than workers", n: 20, workers: 3},
+		{name: "more workers than jobs", n: 2, workers: 8},
+		{name: "no workers falls back to one", n: 5, workers: 0},
+		{name: "no jobs", n: 0, workers: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running, maxRunning int32
+			results := make([]int, tt.n)
+
+			ForEachBounded(tt.n, tt.workers, func(i int) {
+				current := atomic.AddInt32(&running, 1)
+				for {
+					seen := atomic.LoadInt32(&maxRunning)
+					if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				results[i] = i * i
+				atomic.AddInt32(&running, -1)
+			})
+
+			for i, result := range results {
+				assert.Equal(t, i*i, result)
+			}
+			assert.LessOrEqual(t, int(maxRunning), max(tt.workers, 1))
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Condition is a list of alternatives joined by ||, each a list of predicates joined by &&
+type Condition [][]Predicate
+
+// Predicate compares one field of a Record, e.g. status >= 500
+type Predicate struct {
+	Field  string
+	Op     string
+	Values []string
+	regex  *regexp.Regexp
+}
+
+var predicateOps = []string{"==", "!=", ">=", "<=", ">", "<", "=~", "in", "contains"}
+
+var predicateRegex = regexp.MustCompile(`^([\w.@-]+)\s*(==|!=|>=|<=|>|<|=~|\sin\s|\scontains\s)\s*(.*)$`)
+
+// ParseCondition parses e.g. `level in [error,fatal] && msg contains "timeout" || status >= 500`
+// An empty condition returns nil, which matches every line
+func ParseCondition(s string) (Condition, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var condition Condition
+	for _, alternative := range splitOutsideQuotes(s, "||") {
+		var predicates []Predicate
+		for _, clause := range splitOutsideQuotes(alternative, "&&") {
+			p, err := parsePredicate(strings.TrimSpace(clause))
+			if err != nil {
+				return nil, err
+			}
+			predicates = append(predicates, p)
+		}
+		condition = append(condition, predicates)
+	}
+	return condition, nil
+}
+
+func parsePredicate(clause string) (Predicate, error) {
+	m := predicateRegex.FindStringSubmatch(clause)
+	if m == nil {
+		return Predicate{}, fmt.Errorf("%q is not <field> <op> <value>, ops are %s", clause, strings.Join(predicateOps, " "))
+	}
+	p := Predicate{Field: m[1], Op: strings.TrimSpace(m[2])}
+	value := strings.TrimSpace(m[3])
+	if value == "" {
+		return Predicate{}, fmt.Errorf("%q has no value", clause)
+	}
+
+	if p.Op == "in" {
+		if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+			return Predicate{}, fmt.Errorf("%q: in expects a list like [a,b]", clause)
+		}
+		for _, v := range splitOutsideQuotes(value[1:len(value)-1], ",") {
+			p.Values = append(p.Values, unquote(strings.TrimSpace(v)))
+		}
+		return p, nil
+	}
+
+	p.Values = []string{unquote(value)}
+	if p.Op == "=~" {
+		re, err := regexp.Compile(p.Values[0])
+		if err != nil {
+			return Predicate{}, err
+		}
+		p.regex = re
+	}
+	return p, nil
+}
+
+// Match reports whether any alternative has all of its predicates true, a nil condition always matches
+func (c Condition) Match(r Record) bool {
+	if c == nil {
+		return true
+	}
+	for _, predicates := range c {
+		if allMatch(predicates, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func allMatch(predicates []Predicate, r Record) bool {
+	for _, p := range predicates {
+		if !p.Match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match is false when the field is missing, numbers are compared as numbers
+func (p Predicate) Match(r Record) bool {
+	value, ok := r[p.Field]
+	if !ok {
+		return false
+	}
+	switch p.Op {
+	case "in":
+		for _, v := range p.Values {
+			if valuesEqual(value, v) {
+				return true
+			}
+		}
+		return false
+	case "contains":
+		return strings.Contains(value, p.Values[0])
+	case "=~":
+		return p.regex.MatchString(value)
+	}
+
+	switch p.Op {
+	case "==":
+		return valuesEqual(value, p.Values[0])
+	case "!=":
+		return !valuesEqual(value, p.Values[0])
+	}
+
+	cmp := compareValues(value, p.Values[0])
+	switch p.Op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// valuesEqual also matches a status against its class, e.g. 503 == 5xx
+func valuesEqual(value, want string) bool {
+	if statusClassRegex.MatchString(want) {
+		return len(value) == 3 && value[0] == want[0]
+	}
+	return compareValues(value, want) == 0
+}
+
+func compareValues(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	return s
+}
+
+// splitOutsideQuotes splits s by sep, ignoring separators inside double quotes
+func splitOutsideQuotes(s, sep string) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuotes:
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCondition(t *testing.T) {
+	record := Record{
+		"level":   "error",
+		"status":  "503",
+		"msg":     "upstream timeout && retry",
+		"user.id": "42",
+	}
+
+	tests := []struct {
+		condition string
+		expected  bool
+	}{
+		{condition: ``, expected: true},
+		{condition: `level == error`, expected: true},
+		{condition: `level != error`, expected: false},
+		{condition: `level in [error, fatal]`, expected: true},
+		{condition: `level in [warn,"info"]`, expected: false},
+		{condition: `status >= 500`, expected: true},
+		{condition: `status > 503`, expected: false},
+		{condition: `status < 600 && status <= 503`, expected: true},
+		{condition: `status == 503.0`, expected: true},
+		{condition: `msg contains "timeout && retry"`, expected: true},
+		{condition: `msg =~ "^upstream"`, expected: true},
+		{condition: `user.id == 42`, expected: true},
+		{condition: `missing == ""`, expected: false},
+		{condition: `level == fatal || status >= 500`, expected: true},
+		{condition: `level == fatal || status < 500`, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			c, err := ParseCondition(tt.condition)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, c.Match(record))
+		})
+	}
+}
+
+func TestParseCondition_Invalid(t *testing.T) {
+	for _, condition := range []string{
+		`level`,
+		`level ==`,
+		`level ~ error`,
+		`level in error`,
+		`msg =~ "("`,
+		`level == error &&`,
+	} {
+		_, err := ParseCondition(condition)
+		assert.Error(t, err, condition)
+	}
+}
+
+func TestParseCondition_StatusClass(t *testing.T) {
+	c, err := ParseCondition(`status == 5xx`)
+	assert.NoError(t, err)
+	assert.True(t, c.Match(Record{"status": "503"}))
+	assert.False(t, c.Match(Record{"status": "404"}))
+
+	c, err = ParseCondition(`status in [4xx,500]`)
+	assert.NoError(t, err)
+	assert.True(t, c.Match(Record{"status": "404"}))
+	assert.True(t, c.Match(Record{"status": "500"}))
+	assert.False(t, c.Match(Record{"status": "502"}))
+}
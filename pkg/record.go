@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Record holds the fields of one parsed line, nested keys are joined by dots
+type Record map[string]string
+
+// LineParser splits a line into fields, false when the line is not in its format
+type LineParser interface {
+	Parse(line []byte) (Record, bool)
+}
+
+// Line formats understood by --format
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatLTSV = "ltsv"
+)
+
+// NewLineParser returns nil for plain text, lines are then only matched by regex
+func NewLineParser(format string) (LineParser, error) {
+	switch format {
+	case "", FormatText:
+		return nil, nil
+	case FormatJSON:
+		return jsonParser{}, nil
+	case FormatLTSV:
+		return ltsvParser{}, nil
+	}
+	if logFormat, ok := accessLogFormats[format]; ok {
+		return newAccessLogParser(logFormat)
+	}
+	if strings.Contains(format, "$") {
+		return newAccessLogParser(format)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// jsonParser reads one JSON object per line
+type jsonParser struct{}
+
+func (jsonParser) Parse(line []byte) (Record, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil, false
+	}
+	record := make(Record, len(object))
+	flattenJSON(record, "", object)
+	return record, true
+}
+
+func flattenJSON(record Record, prefix string, object map[string]any) {
+	for key, value := range object {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			flattenJSON(record, key, v)
+		case string:
+			record[key] = v
+		case json.Number:
+			record[key] = v.String()
+		case bool:
+			record[key] = strconv.FormatBool(v)
+		case nil:
+			record[key] = ""
+		default:
+			// arrays are kept as JSON, they can still be searched with contains
+			data, _ := json.Marshal(v)
+			record[key] = string(data)
+		}
+	}
+}
+
+// ltsvParser reads tab separated label:value pairs, see http://ltsv.org
+type ltsvParser struct{}
+
+func (ltsvParser) Parse(line []byte) (Record, bool) {
+	record := Record{}
+	for _, pair := range strings.Split(string(line), "\t") {
+		label, value, ok := strings.Cut(pair, ":")
+		if !ok || label == "" {
+			continue
+		}
+		record[label] = value
+	}
+	return record, len(record) > 0
+}
+
+// SplitFields splits the comma separated --fields value
+func SplitFields(fields string) []string {
+	if fields == "" {
+		return nil
+	}
+	names := []string{}
+	for _, name := range strings.Split(fields, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Render shows the given fields as key=value pairs, all fields sorted by key when none are given
+func (r Record) Render(fields []string) string {
+	if len(fields) == 0 {
+		fields = make([]string, 0, len(r))
+		for key := range r {
+			fields = append(fields, key)
+		}
+		sort.Strings(fields)
+	}
+
+	var sb strings.Builder
+	for _, key := range fields {
+		value, ok := r[key]
+		if !ok {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		if value == "" || strings.ContainsAny(value, " \t\"=") {
+			value = strconv.Quote(value)
+		}
+		sb.WriteString(value)
+	}
+	return sb.String()
+}
@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONParser(t *testing.T) {
+	parser, err := NewLineParser(FormatJSON)
+	assert.NoError(t, err)
+
+	record, ok := parser.Parse([]byte(`{"level":"error","status":503,"latency":1.5,"ok":false,"err":{"code":"E42"},"tags":["a","b"],"trace":null}`))
+	assert.True(t, ok)
+	assert.Equal(t, Record{
+		"level":    "error",
+		"status":   "503",
+		"latency":  "1.5",
+		"ok":       "false",
+		"err.code": "E42",
+		"tags":     `["a","b"]`,
+		"trace":    "",
+	}, record)
+
+	for _, line := range []string{"", "plain text", `{"level":`, `["a"]`} {
+		_, ok := parser.Parse([]byte(line))
+		assert.False(t, ok, line)
+	}
+}
+
+func TestNewLineParser(t *testing.T) {
+	parser, err := NewLineParser("")
+	assert.NoError(t, err)
+	assert.Nil(t, parser)
+
+	parser, err = NewLineParser(FormatText)
+	assert.NoError(t, err)
+	assert.Nil(t, parser)
+
+	_, err = NewLineParser("xml")
+	assert.Error(t, err)
+}
+
+func TestRecordRender(t *testing.T) {
+	record := Record{"level": "error", "msg": "upstream timeout", "status": "503"}
+	assert.Equal(t, `level=error status=503 msg="upstream timeout"`, record.Render([]string{"level", "status", "missing", "msg"}))
+	assert.Equal(t, `level=error msg="upstream timeout" status=503`, record.Render(nil))
+	assert.Equal(t, []string{"level", "msg"}, SplitFields(" level, ,msg"))
+}
+
+func TestLTSVParser(t *testing.T) {
+	parser, err := NewLineParser(FormatLTSV)
+	assert.NoError(t, err)
+
+	record, ok := parser.Parse([]byte("time:[01/Jan/2024:10:00:00 +0900]\thost:10.0.0.1\treq:GET /api/users HTTP/1.1\tstatus:503\treqtime:1.234\tempty:"))
+	assert.True(t, ok)
+	assert.Equal(t, Record{
+		"time":    "[01/Jan/2024:10:00:00 +0900]",
+		"host":    "10.0.0.1",
+		"req":     "GET /api/users HTTP/1.1",
+		"status":  "503",
+		"reqtime": "1.234",
+		"empty":   "",
+	}, record)
+
+	_, ok = parser.Parse([]byte("plain text without labels"))
+	assert.False(t, ok)
+}
@@ -83,3 +83,54 @@ func OrderedAsc(slice map[string]int) string {
 
 	return result
 }
+
+// TopCounts renders the n highest counts like OrderedAsc, ties ordered by key,
+// the counts past n are summed up as others
+func TopCounts(counts map[string]int, n int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	parts := make([]string, 0, min(n, len(keys))+1)
+	others := 0
+	for i, k := range keys {
+		if n > 0 && i >= n {
+			others += counts[k]
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d", k, counts[k]))
+	}
+	if others > 0 {
+		parts = append(parts, fmt.Sprintf("others: %d", others))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// StreakBelow is the opposite of NonStreakZero, the last streak counts are all under the minimum
+func StreakBelow(streaks []int, streak int, minimum int) bool {
+	if len(streaks) < streak {
+		return false
+	}
+	for i := 0; i < streak; i++ {
+		if streaks[len(streaks)-1-i] >= minimum {
+			return false
+		}
+	}
+	return true
+}
+
+// StreakRun counts the scans in a row at the end of streaks with at least minimum matches
+func StreakRun(streaks []int, minimum int) int {
+	run := 0
+	for i := len(streaks) - 1; i >= 0 && streaks[i] >= minimum; i-- {
+		run++
+	}
+	return run
+}
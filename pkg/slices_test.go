@@ -0,0 +1,39 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopCounts(t *testing.T) {
+	counts := map[string]int{"/api/b": 5, "/api/a": 5, "/api/c": 9, "/api/d": 1, "/api/e": 2}
+
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{n: 0, expected: "/api/c: 9, /api/a: 5, /api/b: 5, /api/e: 2, /api/d: 1"},
+		{n: 2, expected: "/api/c: 9, /api/a: 5, others: 8"},
+		{n: 5, expected: "/api/c: 9, /api/a: 5, /api/b: 5, /api/e: 2, /api/d: 1"},
+		{n: 10, expected: "/api/c: 9, /api/a: 5, /api/b: 5, /api/e: 2, /api/d: 1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, TopCounts(counts, tt.n))
+	}
+	assert.Equal(t, "", TopCounts(nil, 3))
+}
+
+func TestStreakBelow(t *testing.T) {
+	assert.True(t, StreakBelow([]int{5, 0, 0}, 2, 1))
+	assert.False(t, StreakBelow([]int{0, 1, 0}, 2, 1))
+	assert.False(t, StreakBelow([]int{0}, 2, 1))
+	assert.True(t, StreakBelow([]int{3, 2}, 2, 5))
+}
+
+func TestStreakRun(t *testing.T) {
+	assert.Equal(t, 2, StreakRun([]int{5, 0, 1, 3}, 1))
+	assert.Equal(t, 0, StreakRun([]int{5, 0}, 1))
+	assert.Equal(t, 3, StreakRun([]int{2, 2, 2}, 2))
+	assert.Equal(t, 0, StreakRun([]int{}, 1))
+}
@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateVersion is bumped whenever the on-disk layout of State changes
+const StateVersion = 1
+
+// State is the per file snapshot of everything a Watcher needs to resume
+type State struct {
+	Version      int           `json:"version"`
+	FilePath     string        `json:"file_path"`
+	LastLineNum  int           `json:"last_line_num"`
+	LastFileSize int64         `json:"last_file_size"`
+	Identity     *FileIdentity `json:"identity,omitempty"`
+	LastScanAt   time.Time     `json:"last_scan_at"`
+	ErrorHistory []int         `json:"error_history"`
+	ScanCount    int           `json:"scan_count"`
+	Alert        *Alert        `json:"alert,omitempty"`
+	Baselines    Baselines     `json:"baselines,omitempty"`
+	PendingEnd   int64         `json:"pending_end,omitempty"`
+}
+
+// StateStore persists Watcher state outside of the in memory cache
+type StateStore interface {
+	// Load returns nil without an error when nothing was saved for the key
+	Load(key string) (*State, error)
+	Save(key string, s *State) error
+	// Delete forgets what was saved for the key, nothing saved is not an error
+	Delete(key string) error
+}
+
+// StateKey identifies a file watched by a rule, unnamed rules use the path alone
+func StateKey(f Flags, filePath string) string {
+	if f.Name == "" {
+		return filePath
+	}
+	return f.Name + ":" + filePath
+}
+
+// NewStateStore returns the store configured by the flags, nil keeps state in memory only
+func NewStateStore(f Flags) StateStore {
+	if f.StateDir == "" {
+		return nil
+	}
+	return NewFileStateStore(f.StateDir)
+}
+
+// FileStateStore keeps one JSON file per watched file inside dir
+type FileStateStore struct {
+	dir string
+}
+
+func NewFileStateStore(dir string) *FileStateStore {
+	return &FileStateStore{dir: dir}
+}
+
+func (s *FileStateStore) path(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(h[:])+".json")
+}
+
+func (s *FileStateStore) Load(key string) (*State, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		// a corrupt state file should not stop the watcher, start over instead
+		slog.Warn("Ignoring unreadable state file", "key", key, "error", err.Error())
+		return nil, nil
+	}
+	if state.Version != StateVersion {
+		slog.Warn("Ignoring state file with unknown version", "key", key, "version", state.Version)
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// Save writes to a temp file and renames it so a crash never leaves a partial state file
+func (s *FileStateStore) Save(key string, state *State) error {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return err
+	}
+	state.Version = StateVersion
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".state-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStateStore) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
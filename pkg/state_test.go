@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStateStore_SaveAndLoad(t *testing.T) {
+	store := NewFileStateStore(t.TempDir())
+
+	state, err := store.Load("missing.log")
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	err = store.Save("app.log", &State{
+		FilePath:     "app.log",
+		LastLineNum:  10,
+		LastFileSize: 120,
+		ErrorHistory: []int{0, 3, 1},
+		ScanCount:    4,
+	})
+	assert.NoError(t, err)
+
+	state, err = store.Load("app.log")
+	assert.NoError(t, err)
+	assert.Equal(t, StateVersion, state.Version)
+	assert.Equal(t, 10, state.LastLineNum)
+	assert.Equal(t, int64(120), state.LastFileSize)
+	assert.Equal(t, []int{0, 3, 1}, state.ErrorHistory)
+	assert.Equal(t, 4, state.ScanCount)
+
+	assert.NoError(t, store.Delete("app.log"))
+	state, err = store.Load("app.log")
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+	assert.NoError(t, store.Delete("app.log"))
+}
+
+func TestFileStateStore_IgnoresBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStateStore(dir)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "corrupt json", content: `{"version":`},
+		{name: "unknown version", content: `{"version":999,"scan_count":5}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := os.WriteFile(store.path(tt.name), []byte(tt.content), 0600)
+			assert.NoError(t, err)
+
+			state, err := store.Load(tt.name)
+			assert.NoError(t, err)
+			assert.Nil(t, state)
+		})
+	}
+}
+
+func TestFileStateStore_LeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStateStore(dir)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, store.Save("app.log", &State{ScanCount: i}))
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestWatcherStateSurvivesRestart(t *testing.T) {
+	filePath, err := setupTempFile("line1\nerror:1\n")
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{
+		Match:    "error:1",
+		Streak:   1,
+		StateDir: t.TempDir(),
+	}
+
+	watcher, err := NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, result.IsFirstScan())
+
+	// append while "down", then come back with an empty cache
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = file.WriteString("error:1\nline2\n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	watcher, err = NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+	result, err = watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, result.IsFirstScan())
+	assert.Equal(t, 2, result.ScanCount)
+	assert.Equal(t, 1, result.ErrorCount)
+	assert.Equal(t, []int{1}, result.Streak)
+}
@@ -39,6 +39,8 @@ func LimitString(s string, n int) string {
 var (
 	tg   *timegrinder.TimeGrinder
 	once sync.Once
+	// tgMutex guards tg, the time grinder keeps state between extractions and files are scanned in parallel
+	tgMutex sync.Mutex
 )
 
 func initTimeGrinder() error {
@@ -61,6 +63,8 @@ func SearchDate(input string) string {
 		return ""
 	}
 
+	tgMutex.Lock()
+	defer tgMutex.Unlock()
 	ts, ok, err := tg.Extract([]byte(input))
 	if err != nil || !ok {
 		return ""
@@ -68,6 +72,17 @@ func SearchDate(input string) string {
 	return ts.Format("2006-01-02 15:04:05")
 }
 
+// newLocalTimeGrinder returns a time grinder of its own for --max-age-secs, lines without
+// a zone are written in the local time of the host. SearchDate reads them as UTC for display
+func newLocalTimeGrinder() (*timegrinder.TimeGrinder, error) {
+	grinder, err := timegrinder.NewTimeGrinder(timegrinder.Config{})
+	if err != nil {
+		return nil, err
+	}
+	grinder.SetLocalTime()
+	return grinder, nil
+}
+
 func DisplayableStreakNumber(streak int) int {
 	l := streak * 2
 	if l < 10 {
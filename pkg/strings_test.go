@@ -3,6 +3,7 @@ package pkg
 import (
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestNumberToK(t *testing.T) {
@@ -32,3 +33,20 @@ func TestNumberToK(t *testing.T) {
 		)
 	}
 }
+
+func TestLocalTimeGrinderLeavesSearchDate(t *testing.T) {
+	line := "2024-01-02 03:04:05 error"
+	grinder, err := newLocalTimeGrinder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, ok, err := grinder.Extract([]byte(line))
+	if err != nil || !ok || !ts.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)) {
+		t.Errorf("local grinder read %v (%v, %v); expected the local time", ts, ok, err)
+	}
+
+	// the dates shown in notifications stay as written
+	if date := SearchDate(line); date != "2024-01-02 03:04:05" {
+		t.Errorf("SearchDate(%q) = %s; expected 2024-01-02 03:04:05", line, date)
+	}
+}
@@ -2,40 +2,80 @@ package pkg
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/gravwell/gravwell/v3/timegrinder"
 	"github.com/patrickmn/go-cache"
 )
 
 type Watcher struct {
 	cache           *cache.Cache
+	store           StateStore
+	stateKey        string
 	filePath        string
 	geoIPDB         *GeoIPDatabase
 	lastLineKey     string
 	lastFileSizeKey string
 	errorHistoryKey string
 	scanCountKey    string
+	identityKey     string
+	lastScanKey     string
+	alertKey        string
+	baselineKey     string
+	pendingEndKey   string
 	matchPattern    string
 	ignorePattern   string
 	regexMatch      []*regexp.Regexp // Pre-compiled match regexes
 	regexIgnore     []*regexp.Regexp // Pre-compiled ignore regexes
+	literalMatch    *AhoCorasick     // Literal alternatives of a long match pattern
+	literalIgnore   *AhoCorasick     // Literal alternatives of a long ignore pattern
+	namedMatch      []NamedPattern   // Replace regexMatch when given, counted per name
+	multiline       *Multiline       // Joins lines into events, nil when lines are events
+	parser          LineParser       // Splits lines into fields, nil for plain text
+	where           Condition        // Field predicates a matching line must pass
+	ignoreWhere     Condition        // Field predicates for ignoring lines
+	fields          []string         // Fields shown instead of the raw line
+	captures        []*regexp.Regexp // Match regexes with named capture groups
 	maxBufferMB     int
 	severity        string
 	lastLineNum     int
 	lastFileSize    int64
+	pendingEnd      int64 // end of the multiline event held back by the last scan, 0 when none was
+	lastIdentity    *FileIdentity
+	lastScanAt      time.Time
 	timestampNow    string
 	streak          int
+	minPercent      float64
+	minRate         float64
+	maxAge          time.Duration            // Matches with an older timestamp are stale, 0 counts every match
+	grinder         *timegrinder.TimeGrinder // Reads the timestamps for maxAge, nil when it is 0
+	anomaly         float64                  // A scan counts only this many standard deviations over the baseline, 0 to count every scan
+	hourly          bool                     // One baseline per hour of the day
+	thresholds      *AccessThresholds        // A scan counts only when one is exceeded, nil to count every scan
 }
 
 const limitCountryCount = 25
 
+// limitFieldValues caps the distinct values counted per --fields field
+const limitFieldValues = 25
+
+// limitCaptureValues caps the distinct values counted per named capture group
+const limitCaptureValues = 1000
+
 const previewLineMaxLength = 500
 
+// ctxCheckLines is how often a scan checks whether it was cancelled
+const ctxCheckLines = 1024
+
 // Pattern splitting thresholds
 const (
 	patternSplitThreshold = 500 // Minimum length to consider splitting
@@ -106,6 +146,78 @@ func splitAndCompilePattern(pattern string) ([]*regexp.Regexp, error) {
 	return regexes, nil
 }
 
+// compilePattern moves the plain literal alternatives of a long pattern into an
+// Aho-Corasick automaton, the rest is compiled by splitAndCompilePattern
+func compilePattern(pattern string) (*AhoCorasick, []*regexp.Regexp, error) {
+	if len(pattern) < patternSplitThreshold || flagGroupRegex.MatchString(pattern) {
+		regexes, err := splitAndCompilePattern(pattern)
+		return nil, regexes, err
+	}
+	var literals, others []string
+	for _, alternative := range splitAlternatives(pattern) {
+		if literal, ok := literalOf(alternative); ok {
+			literals = append(literals, literal)
+		} else {
+			others = append(others, alternative)
+		}
+	}
+	if len(literals) == 0 {
+		regexes, err := splitAndCompilePattern(pattern)
+		return nil, regexes, err
+	}
+
+	regexes, err := splitAndCompilePattern(strings.Join(others, "|"))
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.Debug("Matching literals in one pass", "literals", len(literals), "regexes", len(regexes))
+	return NewAhoCorasick(literals), regexes, nil
+}
+
+// flagGroupRegex finds flags such as (?i), they apply to the alternatives after them
+var flagGroupRegex = regexp.MustCompile(`\(\?[imsU-]+\)`)
+
+// splitAlternatives splits a pattern by the | outside of groups and character classes
+func splitAlternatives(pattern string) []string {
+	var parts []string
+	depth := 0
+	inClass := false
+	start := 0
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; {
+		case ch == '\\':
+			i++
+		case inClass:
+			inClass = ch != ']'
+		case ch == '[':
+			inClass = true
+			// a ] right after [ or [^ is part of the class
+			if strings.HasPrefix(pattern[i+1:], "^]") {
+				i += 2
+			} else if strings.HasPrefix(pattern[i+1:], "]") {
+				i++
+			}
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == '|' && depth == 0:
+			parts = append(parts, pattern[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, pattern[start:])
+}
+
+// literalOf returns the text an alternative matches when it has no regex operators
+func literalOf(alternative string) (string, bool) {
+	re, err := syntax.Parse(alternative, syntax.Perl)
+	if err != nil || re.Op != syntax.OpLiteral || re.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+	return string(re.Rune), true
+}
+
 // splitPattern splits a regex pattern by | separators
 // Escaped pipes (\|) are NOT used as split points - they are kept as part of the pattern
 func splitPattern(pattern string) []string {
@@ -161,9 +273,10 @@ func NewWatcher(
 ) (*Watcher, error) {
 	now := time.Now()
 
-
 	watcher := &Watcher{
 		cache:           c,
+		store:           NewStateStore(f),
+		stateKey:        StateKey(f, filePath),
 		filePath:        filePath,
 		geoIPDB:         geoIPDB,
 		matchPattern:    f.Match,
@@ -172,21 +285,67 @@ func NewWatcher(
 		lastFileSizeKey: "sk-" + filePath,
 		errorHistoryKey: "eh-" + filePath,
 		scanCountKey:    "sc-" + filePath,
+		identityKey:     "fi-" + filePath,
+		lastScanKey:     "ls-" + filePath,
+		alertKey:        alertCacheKey(filePath),
+		baselineKey:     "bl-" + filePath,
+		pendingEndKey:   "pe-" + filePath,
 		timestampNow:    now.Format("2006-01-02 15:04:05"),
 		maxBufferMB:     f.MaxBufferMB,
 		severity:        f.Severity,
 		streak:          DisplayableStreakNumber(f.Streak),
+		minPercent:      f.MinPercent,
+		minRate:         f.MinRate,
+		maxAge:          time.Duration(f.MaxAgeSecs) * time.Second,
+		anomaly:         f.Anomaly,
+		hourly:          f.AnomalyHourly,
 	}
 
 	// Pre-compile match regexes
 	var err error
-	watcher.regexMatch, err = splitAndCompilePattern(f.Match)
+	watcher.literalMatch, watcher.regexMatch, err = compilePattern(f.Match)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher.namedMatch, err = f.NamedMatch.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	watcher.multiline, err = NewMultiline(f.MultilineStart, f.MultilineContinue, f.MultilineMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher.parser, err = NewLineParser(f.Format)
+	if err != nil {
+		return nil, err
+	}
+	watcher.where, err = ParseCondition(f.Where)
+	if err != nil {
+		return nil, err
+	}
+	watcher.ignoreWhere, err = ParseCondition(f.IgnoreWhere)
+	if err != nil {
+		return nil, err
+	}
+	watcher.fields = SplitFields(f.Fields)
+	watcher.captures = withCaptures(watcher.regexMatch, watcher.namedMatch)
+	watcher.thresholds, err = ParseAccessThresholds(f.StatusPercent, f.Latency)
 	if err != nil {
 		return nil, err
 	}
+	if watcher.maxAge > 0 {
+		// one per watcher, scans of other files do not wait on a shared one
+		watcher.grinder, err = newLocalTimeGrinder()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Pre-compile ignore regexes
-	watcher.regexIgnore, err = splitAndCompilePattern(f.Ignore)
+	watcher.literalIgnore, watcher.regexIgnore, err = compilePattern(f.Ignore)
 	if err != nil {
 		return nil, err
 	}
@@ -202,8 +361,10 @@ type ScanResult struct {
 	FilePath      string
 	FileInfo      os.FileInfo
 	ErrorCount    int
+	StaleCount    int // Matches skipped for a timestamp older than --max-age-secs
 	ErrorPercent  float64
-	Severity   string
+	ErrorRate     float64 // Matches per second since the previous scan
+	Severity      string
 	LinesRead     int
 	FirstLine     string
 	FirstDate     string
@@ -211,95 +372,123 @@ type ScanResult struct {
 	PreviewLine   string
 	LastLine      string
 	LastDate      string
-	Streak        []int // History of error counts for this file path
-	ScanCount     int   // Total number of scans performed
+	Streak        []int                     // History of error counts for this file path
+	ScanCount     int                       // Total number of scans performed
+	MatchCounts   map[string]int            // Matches by --named-match name
+	FieldCounts   map[string]map[string]int // Values of the --fields fields in matched lines
+	CaptureCounts map[string]map[string]int // Values of the named capture groups in matched lines
+	Access        *AccessStats              // Requests of the scan, nil when the lines have no status
+	Exceeded      []string                  // --status-percent and --latency thresholds the scan is over
+	Anomaly       *Anomaly                  // Matches against the baseline of the file, nil without --anomaly
+	Rotation      Rotation                  // How the file changed since the previous scan
+	RotatedFile   string                    // Rotated away file whose unread tail was counted in this scan
+	Alert         AlertAction               // What the alert lifecycle asks the notifiers to send
+	AlertState    AlertState                // Where the alert of the rule and file is after the scan
+	AlertReason   string                    // Why the rule alerts on the file, empty when clear
+	Suppressed    int                       // Triggers held back since the previous notification
 }
 
 func (r *ScanResult) IsFirstScan() bool {
 	return r.ScanCount == 1
 }
 
-func (w *Watcher) Scan() (*ScanResult, error) {
-	matchCounts := 0
-	firstLine := ""
-	lastLine := ""
-	previewLine := ""
+// scanTally accumulates the matches of one Scan, possibly across several files
+type scanTally struct {
+	matchCounts   int
+	staleCounts   int
+	staleBefore   time.Time // matches with an older timestamp are stale, zero when --max-age-secs is off
+	grinder       *timegrinder.TimeGrinder
+	namedCounts   map[string]int
+	fieldCounts   map[string]map[string]int
+	captureCounts map[string]map[string]int
+	access        *AccessStats
+	drainedLines  int
+	events        int // multiline events tallied
+	firstLine     string
+	lastLine      string
+	previewLine   string
+	firstRaw      string // firstLine before --fields were applied, searched for the date
+	lastRaw       string
+	countryCounts map[string]int
+}
 
-	fileInfo, err := os.Stat(w.filePath)
+// Scan reads what was appended since the last scan, when ctx is cancelled the
+// scan stops without saving state so the same lines are read again next time
+func (w *Watcher) Scan(ctx context.Context) (*ScanResult, error) {
+	file, err := os.Open(w.filePath)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	currentFileSize := fileInfo.Size()
-
-	// Detect log rotation
-	if currentFileSize+2 < w.lastFileSize {
-		w.lastFileSize = 0
-	}
-
-	file, err := os.Open(w.filePath)
+	fileInfo, err := file.Stat()
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	if _, err := file.Seek(w.lastFileSize, io.SeekStart); err != nil {
+	currentFileSize := fileInfo.Size()
+
+	identity, head, err := NewFileIdentity(file, fileInfo)
+	if err != nil {
 		return nil, err
 	}
 
-	scanner := bufio.NewScanner(file)
-	if w.maxBufferMB > 0 {
-		// For large lines
-		scanner.Buffer(make([]byte, 0, 64*1024), w.maxBufferMB*1024*1024)
-	}
-	currentLineNum := 1
-	linesRead := 0
-	bytesRead := w.lastFileSize
 	isFirstScan := w.getScanCount() == 0
-	countryCounts := make(map[string]int)
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		bytesRead += int64(len(line)) + 1 // Adding 1 for the newline character
-		currentLineNum++
-		linesRead = currentLineNum - w.lastLineNum
-		// Convert to positive number
-		if linesRead < 0 {
-			linesRead = -linesRead
-		}
-
-		if isFirstScan {
-			continue
-		}
-
-		if w.matchesAny(w.regexIgnore, line) {
-			continue
-		}
-		if w.matchesAny(w.regexMatch, line) {
-			lineStr := string(line)
-
-			if len(countryCounts) < limitCountryCount {
-				cc := w.geoIPDB.GetCountryCounts(SearchIPAddresses(lineStr))
-				for country, count := range cc {
-					countryCounts[country] += count
-				}
-			}
-
-			if firstLine == "" {
-				firstLine = lineStr
-			}
-			if len(previewLine) < previewLineMaxLength {
-				previewLine += lineStr + "\n\r"
+	tally := &scanTally{
+		namedCounts:   make(map[string]int),
+		fieldCounts:   make(map[string]map[string]int),
+		captureCounts: make(map[string]map[string]int),
+		countryCounts: make(map[string]int),
+	}
+	if w.parser != nil && w.thresholds != nil {
+		tally.access = NewAccessStats()
+	}
+	if w.maxAge > 0 {
+		tally.staleBefore = time.Now().Add(-w.maxAge)
+		tally.grinder = w.grinder
+	}
+	rotatedFilePath := ""
+
+	// Detect log rotation, start over only when the file is no longer the one we read
+	rotation := DetectRotation(w.lastIdentity, w.lastFileSize, identity, head, currentFileSize)
+	if rotation != RotationNone {
+		slog.Info("Log rotation detected", "filePath", w.filePath, "rotation", rotation.String())
+		if rotation == RotationRenamed && !isFirstScan {
+			// cut short, nothing is saved and the rotated file is drained again next scan
+			if rotatedFilePath, err = w.drainRotated(ctx, tally); err != nil {
+				return nil, err
 			}
-			lastLine = lineStr
-			matchCounts++
 		}
+		w.lastFileSize = 0
+		w.pendingEnd = 0
 	}
 
-	if err := scanner.Err(); err != nil {
+	// an archive never grows, its lines are matched on the first scan instead of skipped
+	compression := DetectCompression(head)
+	bytesRead, lines, err := w.scanFile(ctx, file, compression, currentFileSize, tally, isFirstScan && compression == CompressionNone)
+	if err != nil {
 		return nil, err
 	}
 
+	if rotation != RotationNone {
+		w.lastLineNum = 0
+	}
+	linesRead := lines + tally.drainedLines
+	matchCounts := tally.matchCounts
+
+	// the rate is over the time since the previous scan, unknown on the first one
+	scannedAt := time.Now()
+	errorRate := 0.0
+	if !w.lastScanAt.IsZero() {
+		if elapsed := scannedAt.Sub(w.lastScanAt).Seconds(); elapsed > 0 {
+			errorRate = float64(matchCounts) / elapsed
+		}
+	}
+
+	// with --multiline the matches are events, so are the lines they are a percent of
+	if w.multiline != nil {
+		linesRead = tally.events
+	}
 	matchPercentage := 0.0
 	if linesRead > 0 {
 		matchPercentage = float64(matchCounts) * 100 / float64(linesRead)
@@ -311,14 +500,35 @@ func (w *Watcher) Scan() (*ScanResult, error) {
 	// Restrict to two decimal places
 	matchPercentage = float64(int(matchPercentage*100)) / 100
 
-	w.lastLineNum = currentLineNum
+	w.lastLineNum += lines
 	w.lastFileSize = bytesRead
+	w.lastScanAt = scannedAt
+	w.lastIdentity = identity
 
 	// Update scan count
 	w.incrementScanCount()
 
+	access, exceeded := w.checkAccess(tally.access)
+	historyCount := matchCounts
+	if w.thresholds != nil {
+		historyCount = 0
+		if len(exceeded) > 0 {
+			historyCount = max(matchCounts, 1)
+		}
+	}
+	if !w.meetsRatios(matchPercentage, errorRate) {
+		historyCount = 0
+	}
+	var anomaly *Anomaly
+	if w.anomaly > 0 && !isFirstScan {
+		anomaly = w.scoreBaseline(matchCounts, scannedAt)
+		if anomaly.Score < w.anomaly {
+			historyCount = 0
+		}
+	}
+
 	// Update error history
-	w.updateErrorHistory(matchCounts)
+	w.updateErrorHistory(historyCount)
 
 	// Save state
 	if err := w.saveState(); err != nil {
@@ -333,22 +543,349 @@ func (w *Watcher) Scan() (*ScanResult, error) {
 
 	return &ScanResult{
 		ErrorCount:    matchCounts,
-		FirstDate:     SearchDate(firstLine),
-		LastDate:      SearchDate(lastLine),
-		FirstLine:     firstLine,
-		PreviewLine:   previewLine,
-		LastLine:      lastLine,
+		StaleCount:    tally.staleCounts,
+		FirstDate:     SearchDate(tally.firstRaw),
+		LastDate:      SearchDate(tally.lastRaw),
+		FirstLine:     tally.firstLine,
+		PreviewLine:   tally.previewLine,
+		LastLine:      tally.lastLine,
 		FilePath:      w.filePath,
 		FileInfo:      fileInfo,
 		ErrorPercent:  matchPercentage,
+		ErrorRate:     errorRate,
 		Severity:      w.severity,
 		LinesRead:     linesRead,
 		Streak:        errorHistory,
 		ScanCount:     scanCount,
-		CountryCounts: countryCounts,
+		CountryCounts: tally.countryCounts,
+		MatchCounts:   tally.namedCounts,
+		FieldCounts:   tally.fieldCounts,
+		CaptureCounts: tally.captureCounts,
+		Access:        access,
+		Exceeded:      exceeded,
+		Anomaly:       anomaly,
+		Rotation:      rotation,
+		RotatedFile:   rotatedFilePath,
 	}, nil
 }
 
+// scanFile reads the file from the saved offset and returns the new offset
+// Compressed archives are immutable, they are streamed once in full and the
+// offset is only a marker that the whole file was consumed
+func (w *Watcher) scanFile(ctx context.Context, file *os.File, compression Compression, size int64, tally *scanTally, skipMatching bool) (int64, int, error) {
+	if compression == CompressionNone {
+		if _, err := file.Seek(w.lastFileSize, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		bytesRead, lines, err := w.scanFrom(ctx, file, tally, skipMatching, true)
+		return w.lastFileSize + bytesRead, lines, err
+	}
+
+	if w.lastFileSize >= size {
+		return w.lastFileSize, 0, nil
+	}
+	reader, err := NewDecompressReader(file, compression)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer reader.Close()
+
+	// a truncated archive errors out here and is retried on the next scan
+	_, lines, err := w.scanFrom(ctx, reader, tally, skipMatching, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	return size, lines, nil
+}
+
+// scanFrom tallies the events of r and returns the bytes and lines consumed
+// With hold, a multiline event cut by the end of the file is not consumed but read
+// again by the next scan, the lines appended to it by then are part of it. An
+// event that did not grow since the previous scan held it back is complete
+func (w *Watcher) scanFrom(ctx context.Context, r io.Reader, tally *scanTally, skipMatching, hold bool) (int64, int, error) {
+	scanner := bufio.NewScanner(r)
+	if w.maxBufferMB > 0 {
+		// For large lines
+		scanner.Buffer(make([]byte, 0, 64*1024), w.maxBufferMB*1024*1024)
+	}
+
+	var joiner *eventJoiner
+	if w.multiline != nil && !skipMatching {
+		joiner = w.multiline.joiner()
+	}
+
+	var bytesRead int64
+	lines := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		offset := bytesRead
+		bytesRead += int64(len(line)) + 1 // Adding 1 for the newline character
+		lines++
+		if lines%ctxCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return bytesRead, lines, err
+			}
+		}
+
+		if skipMatching {
+			continue
+		}
+		if joiner != nil {
+			event, ok := joiner.add(line, offset, lines-1)
+			if !ok {
+				continue
+			}
+			line = event
+			tally.events++
+		}
+		w.tallyLine(tally, line)
+	}
+	if joiner == nil || !joiner.pending {
+		return bytesRead, lines, scanner.Err()
+	}
+	end := w.lastFileSize + bytesRead
+	if hold && (joiner.start > 0 || end != w.pendingEnd) {
+		w.pendingEnd = end
+		return joiner.start, joiner.before, scanner.Err()
+	}
+	if hold {
+		w.pendingEnd = 0
+	}
+	event, _ := joiner.flush()
+	tally.events++
+	w.tallyLine(tally, event)
+	return bytesRead, lines, scanner.Err()
+}
+
+func (w *Watcher) tallyLine(tally *scanTally, line []byte) {
+	if w.literalIgnore.Match(line) || w.matchesAny(w.regexIgnore, line) {
+		return
+	}
+	// the request stats and --ignore-where need every line parsed, otherwise only the matching ones are
+	eager := tally.access != nil || w.ignoreWhere != nil
+	var record Record
+	var ok bool
+	if eager {
+		record, ok = w.parse(line)
+		if ok && w.ignoreWhere != nil && w.ignoreWhere.Match(record) {
+			return
+		}
+		if ok && tally.access != nil {
+			tally.access.add(record)
+		}
+	}
+	if !w.matches(tally, line) {
+		return
+	}
+	if !eager {
+		record, ok = w.parse(line)
+	}
+	if w.where != nil && !w.where.Match(record) {
+		return
+	}
+	raw := string(line)
+	if tally.isStale(raw) {
+		tally.staleCounts++
+		return
+	}
+	lineStr := raw
+	if ok && len(w.fields) > 0 {
+		lineStr = record.Render(w.fields)
+		tally.countFields(record, w.fields)
+	}
+	w.countCaptures(tally, line)
+
+	if len(tally.countryCounts) < limitCountryCount {
+		cc := w.geoIPDB.GetCountryCounts(SearchIPAddresses(raw))
+		for country, count := range cc {
+			tally.countryCounts[country] += count
+		}
+	}
+
+	if tally.firstLine == "" {
+		tally.firstLine = lineStr
+		tally.firstRaw = raw
+	}
+	if len(tally.previewLine) < previewLineMaxLength {
+		tally.previewLine += lineStr + "\n\r"
+	}
+	tally.lastLine = lineStr
+	tally.lastRaw = raw
+	tally.matchCounts++
+}
+
+// isStale checks the timestamp of the line against --max-age-secs, lines without one are never stale
+func (t *scanTally) isStale(line string) bool {
+	if t.staleBefore.IsZero() {
+		return false
+	}
+	ts, ok, err := t.grinder.Extract([]byte(line))
+	return err == nil && ok && ts.Before(t.staleBefore)
+}
+
+// countFields counts the values of the selected fields
+func (t *scanTally) countFields(record Record, fields []string) {
+	for _, field := range fields {
+		if value, ok := record[field]; ok {
+			countValue(t.fieldCounts, field, value, limitFieldValues)
+		}
+	}
+}
+
+// countValue counts value under key, new values past the limit are dropped
+func countValue(counts map[string]map[string]int, key, value string, limit int) {
+	values := counts[key]
+	if values == nil {
+		values = make(map[string]int)
+		counts[key] = values
+	}
+	if _, seen := values[value]; seen || len(values) < limit {
+		values[value]++
+	}
+}
+
+// countCaptures counts the values of the named capture groups in the match patterns
+func (w *Watcher) countCaptures(tally *scanTally, line []byte) {
+	for _, re := range w.captures {
+		m := re.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for i, name := range re.SubexpNames() {
+			if name != "" && m[i] != nil {
+				countValue(tally.captureCounts, name, string(m[i]), limitCaptureValues)
+			}
+		}
+	}
+}
+
+// meetsRatios checks --min-percent and --min-rate, a scan below either does not count towards the streak
+func (w *Watcher) meetsRatios(percent, rate float64) bool {
+	if w.minPercent > 0 && percent < w.minPercent {
+		return false
+	}
+	if w.minRate > 0 && rate < w.minRate {
+		return false
+	}
+	return true
+}
+
+// scoreBaseline compares the matches of the scan to the baseline of the file and learns from them
+func (w *Watcher) scoreBaseline(matches int, now time.Time) *Anomaly {
+	baselines := w.getBaselines()
+	anomaly := baselines.At(now).Score(matches)
+	w.cache.Set(w.baselineKey, baselines, cache.DefaultExpiration)
+	return anomaly
+}
+
+// getBaselines returns the learned baselines, empty ones when --anomaly-hourly was switched
+func (w *Watcher) getBaselines() Baselines {
+	if value, found := w.cache.Get(w.baselineKey); found {
+		baselines := value.(Baselines)
+		if len(baselines) == len(NewBaselines(w.hourly)) {
+			return baselines
+		}
+	}
+	return NewBaselines(w.hourly)
+}
+
+// checkAccess returns the request stats of the scan and the thresholds they exceed
+func (w *Watcher) checkAccess(access *AccessStats) (*AccessStats, []string) {
+	if access == nil || access.Requests == 0 {
+		access = nil
+	} else {
+		sort.Float64s(access.Latencies)
+	}
+	if w.thresholds == nil {
+		return access, nil
+	}
+	return access, w.thresholds.Exceeded(access)
+}
+
+// parse splits the line into fields when a --format is set
+func (w *Watcher) parse(line []byte) (Record, bool) {
+	if w.parser == nil {
+		return nil, false
+	}
+	return w.parser.Parse(line)
+}
+
+// drainRotated finishes reading the rotated away file from the saved offset
+// so lines written between the last scan and the rotation are not lost
+// An error is only returned when ctx is done, the other errors skip the unread lines
+func (w *Watcher) drainRotated(ctx context.Context, tally *scanTally) (string, error) {
+	rotatedFilePath, err := FindRotatedFile(w.filePath, w.lastIdentity)
+	if err != nil || rotatedFilePath == "" {
+		slog.Warn("Rotated file not found, unread lines are skipped", "filePath", w.filePath)
+		return "", nil
+	}
+
+	file, err := os.Open(rotatedFilePath)
+	if err != nil {
+		slog.Warn("Error opening rotated file", "error", err.Error(), "filePath", rotatedFilePath)
+		return "", nil
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(w.lastFileSize, io.SeekStart); err != nil {
+		slog.Warn("Error seeking rotated file", "error", err.Error(), "filePath", rotatedFilePath)
+		return "", nil
+	}
+	_, lines, err := w.scanFrom(ctx, file, tally, false, false)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		slog.Warn("Error draining rotated file", "error", err.Error(), "filePath", rotatedFilePath)
+	}
+	tally.drainedLines += lines
+	slog.Info("Drained rotated file", "filePath", rotatedFilePath, "lines", lines)
+	return rotatedFilePath, nil
+}
+
+// withCaptures returns the regexes having named capture groups
+func withCaptures(regexMatch []*regexp.Regexp, namedMatch []NamedPattern) []*regexp.Regexp {
+	var captures []*regexp.Regexp
+	if len(namedMatch) == 0 {
+		for _, re := range regexMatch {
+			if hasNamedGroup(re) {
+				captures = append(captures, re)
+			}
+		}
+	}
+	for _, p := range namedMatch {
+		if hasNamedGroup(p.Regex) {
+			captures = append(captures, p.Regex)
+		}
+	}
+	return captures
+}
+
+func hasNamedGroup(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// matches checks the line against the named patterns when given, counting every
+// name that matched, or against --match otherwise
+func (w *Watcher) matches(tally *scanTally, line []byte) bool {
+	if len(w.namedMatch) == 0 {
+		return w.literalMatch.Match(line) || w.matchesAny(w.regexMatch, line)
+	}
+	matched := false
+	for _, p := range w.namedMatch {
+		if p.Regex.Match(line) {
+			tally.namedCounts[p.Name]++
+			matched = true
+		}
+	}
+	return matched
+}
+
 // matchesAny checks if the line matches any of the regexes in the slice
 func (w *Watcher) matchesAny(regexes []*regexp.Regexp, line []byte) bool {
 	for _, re := range regexes {
@@ -360,21 +897,144 @@ func (w *Watcher) matchesAny(regexes []*regexp.Regexp, line []byte) bool {
 }
 
 func (w *Watcher) loadState() error {
+	// Only fall back to the store when the in memory cache is cold, i.e. after a restart
+	if _, found := w.cache.Get(w.scanCountKey); !found && w.store != nil {
+		state, err := w.store.Load(w.stateKey)
+		if err != nil {
+			return err
+		}
+		if state != nil {
+			w.restoreState(state)
+		}
+	}
 	if value, found := w.cache.Get(w.lastLineKey); found {
 		w.lastLineNum = value.(int)
 	}
 	if value, found := w.cache.Get(w.lastFileSizeKey); found {
 		w.lastFileSize = value.(int64)
 	}
+	if value, found := w.cache.Get(w.identityKey); found {
+		w.lastIdentity = value.(*FileIdentity)
+	}
+	if value, found := w.cache.Get(w.lastScanKey); found {
+		w.lastScanAt = value.(time.Time)
+	}
+	if value, found := w.cache.Get(w.pendingEndKey); found {
+		w.pendingEnd = value.(int64)
+	}
 	return nil
 }
 
 func (w *Watcher) saveState() error {
 	w.cache.Set(w.lastLineKey, w.lastLineNum, cache.DefaultExpiration)
 	w.cache.Set(w.lastFileSizeKey, w.lastFileSize, cache.DefaultExpiration)
+	w.cache.Set(w.identityKey, w.lastIdentity, cache.DefaultExpiration)
+	w.cache.Set(w.lastScanKey, w.lastScanAt, cache.DefaultExpiration)
+	w.cache.Set(w.pendingEndKey, w.pendingEnd, cache.DefaultExpiration)
+	if w.store == nil {
+		return nil
+	}
+	return w.store.Save(w.stateKey, &State{
+		FilePath:     w.filePath,
+		LastLineNum:  w.lastLineNum,
+		LastFileSize: w.lastFileSize,
+		Identity:     w.lastIdentity,
+		LastScanAt:   w.lastScanAt,
+		ErrorHistory: w.getErrorHistory(),
+		ScanCount:    w.getScanCount(),
+		Alert:        w.getAlert(),
+		Baselines:    w.storedBaselines(),
+		PendingEnd:   w.pendingEnd,
+	})
+}
+
+// restoreState seeds the cache from a persisted State
+func (w *Watcher) restoreState(state *State) {
+	w.cache.Set(w.lastLineKey, state.LastLineNum, cache.DefaultExpiration)
+	w.cache.Set(w.lastFileSizeKey, state.LastFileSize, cache.DefaultExpiration)
+	w.cache.Set(w.scanCountKey, state.ScanCount, cache.DefaultExpiration)
+	w.cache.Set(w.pendingEndKey, state.PendingEnd, cache.DefaultExpiration)
+	if state.Identity != nil {
+		w.cache.Set(w.identityKey, state.Identity, cache.DefaultExpiration)
+	}
+	if !state.LastScanAt.IsZero() {
+		w.cache.Set(w.lastScanKey, state.LastScanAt, cache.DefaultExpiration)
+	}
+	if len(state.ErrorHistory) > 0 {
+		w.cache.Set(w.errorHistoryKey, state.ErrorHistory, cache.DefaultExpiration)
+	}
+	if state.Alert != nil {
+		w.cache.Set(w.alertKey, *state.Alert, cache.DefaultExpiration)
+	}
+	if len(state.Baselines) > 0 {
+		w.cache.Set(w.baselineKey, state.Baselines, cache.DefaultExpiration)
+	}
+}
+
+// storedBaselines returns what was learned so far, nil without --anomaly
+func (w *Watcher) storedBaselines() Baselines {
+	if value, found := w.cache.Get(w.baselineKey); found {
+		return value.(Baselines)
+	}
 	return nil
 }
 
+// UpdateAlert moves the alert of the file on the outcome of the scan and sets what to notify on the result
+func (w *Watcher) UpdateAlert(result *ScanResult, f Flags, now time.Time) error {
+	result.AlertReason = AlertReason(result, f, now)
+	alert := *w.getAlert()
+	repeat := alert.State == AlertFiring
+	result.Alert = alert.Next(result.AlertReason != "", f.ResolveAfter, f.PagerDutyAck)
+	result.AlertState = alert.State
+	if result.Alert == AlertTrigger {
+		if f.Escalate && !f.Absent {
+			result.Severity = EscalatedSeverity(result, f)
+		}
+		cooldown := time.Duration(f.CooldownSecs) * time.Second
+		renotify := time.Duration(f.RenotifySecs) * time.Second
+		result.Alert, result.Suppressed = alert.Throttle(now, cooldown, renotify, repeat, result.Severity)
+	}
+	if (result.Alert == AlertResolve || result.Alert == AlertAcknowledge) && alert.Severity != "" {
+		// carry the severity of the incident being closed, not the static --severity
+		result.Severity = alert.Severity
+	}
+	w.cache.Set(w.alertKey, alert, cache.DefaultExpiration)
+	return w.saveState()
+}
+
+func (w *Watcher) getAlert() *Alert {
+	if value, found := w.cache.Get(w.alertKey); found {
+		alert := value.(Alert)
+		return &alert
+	}
+	return &Alert{State: AlertOK}
+}
+
+func alertCacheKey(filePath string) string {
+	return "al-" + filePath
+}
+
+// StoredAlert returns the alert of a rule and file without scanning it, from the
+// cache of the file or else from --state-dir
+func StoredAlert(f Flags, filePath string, c *cache.Cache) *Alert {
+	if value, found := c.Get(alertCacheKey(filePath)); found {
+		alert := value.(Alert)
+		return &alert
+	}
+	if store := NewStateStore(f); store != nil {
+		state, err := store.Load(StateKey(f, filePath))
+		if err == nil && state != nil && state.Alert != nil {
+			return state.Alert
+		}
+	}
+	return &Alert{State: AlertOK}
+}
+
+// KeepAlert seeds the cache of a file with an alert, the next scans move it on
+func KeepAlert(filePath string, alert *Alert, c *cache.Cache) {
+	c.Set(alertCacheKey(filePath), *alert, cache.DefaultExpiration)
+}
+
 func (w *Watcher) updateErrorHistory(newErrorCount int) {
 	if w.getScanCount() == 1 {
 		return
@@ -1,9 +1,13 @@
 package pkg
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/patrickmn/go-cache"
 	"github.com/stretchr/testify/assert"
@@ -68,7 +72,7 @@ error:1`
 	assert.NoError(t, err)
 	defer watcher.Close()
 
-	result, err := watcher.Scan()
+	result, err := watcher.Scan(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, 2, result.ErrorCount)
 	assert.Equal(t, "error:1", result.FirstLine)
@@ -98,7 +102,7 @@ line2`
 	assert.NoError(t, err)
 	defer watcher.Close()
 
-	result, err := watcher.Scan()
+	result, err := watcher.Scan(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, 1, result.ErrorCount)
 	assert.Equal(t, "error:1", result.FirstLine)
@@ -108,7 +112,7 @@ line2`
 	err = os.WriteFile(filePath, []byte("error:1\n"), 0644) // nolint: gosec
 	assert.NoError(t, err)
 
-	result, err = watcher.Scan()
+	result, err = watcher.Scan(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, 1, result.ErrorCount)
 	assert.Equal(t, "error:1", result.FirstLine)
@@ -145,7 +149,7 @@ error:1`
 	defer watcher.Close()
 
 	for i := 0; i < b.N; i++ {
-		_, err := watcher.Scan()
+		_, err := watcher.Scan(context.Background())
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -621,7 +625,7 @@ error or warning
 	assert.NoError(t, err)
 	defer watcher.Close()
 
-	result, err := watcher.Scan()
+	result, err := watcher.Scan(context.Background())
 	assert.NoError(t, err)
 	// Should only match "error|warning found" line, not the others
 	assert.Equal(t, 1, result.ErrorCount, "Should match only the line with literal pipe")
@@ -656,7 +660,7 @@ info found
 	assert.NoError(t, err)
 	defer watcher.Close()
 
-	result, err := watcher.Scan()
+	result, err := watcher.Scan(context.Background())
 	assert.NoError(t, err)
 	// Should match both "error found" and "warning found", but not "info found"
 	assert.Equal(t, 2, result.ErrorCount, "Should match lines with either error or warning")
@@ -689,15 +693,126 @@ func TestLongPatternPerformance(t *testing.T) {
 	assert.NoError(t, err)
 	defer watcher.Close()
 
-	// Verify that the pattern was split
-	assert.Greater(t, len(watcher.regexMatch), 1, "Expected long pattern to be split")
+	// Verify that the literal alternatives are matched in one pass instead of split regexes
+	assert.NotNil(t, watcher.literalMatch, "Expected literals to be matched by the automaton")
+	assert.Empty(t, watcher.regexMatch, "Expected no regex for a literal only pattern")
 
 	// Verify that scanning still works correctly
-	result, err := watcher.Scan()
+	result, err := watcher.Scan(context.Background())
 	assert.NoError(t, err)
 	assert.Greater(t, result.ErrorCount, 0, "Should find matches with split pattern")
 }
 
+// longKeywordPattern is an ignore list like the ones in production, plain literals and a few regexes
+func longKeywordPattern(literals int) string {
+	parts := make([]string, 0, literals+2)
+	for i := 0; i < literals; i++ {
+		parts = append(parts, fmt.Sprintf("known-noise-%03d occurred", i))
+	}
+	parts = append(parts, `user \d+ logged out`, `GET /health(check)?`)
+	return strings.Join(parts, "|")
+}
+
+func TestCompilePatternLiterals(t *testing.T) {
+	pattern := longKeywordPattern(100)
+	literals, regexes, err := compilePattern(pattern)
+	assert.NoError(t, err)
+	assert.NotNil(t, literals)
+	assert.Len(t, regexes, 1)
+
+	whole := regexp.MustCompile(pattern)
+	for _, line := range []string{
+		"2024-01-01 known-noise-042 occurred",
+		"2024-01-01 known-noise-099 occurred twice",
+		"user 42 logged out",
+		"GET /healthcheck 200",
+		"known-noise-100 occurred",
+		"known-noise-042",
+		"an unrelated error",
+	} {
+		matched := literals.Match([]byte(line))
+		for _, re := range regexes {
+			matched = matched || re.MatchString(line)
+		}
+		assert.Equal(t, whole.MatchString(line), matched, line)
+	}
+}
+
+func TestCompilePatternKeepsRegexSemantics(t *testing.T) {
+	padding := strings.Repeat("x", patternSplitThreshold)
+	tests := []struct {
+		name     string
+		pattern  string
+		literals bool
+	}{
+		{name: "short pattern", pattern: "error|warning", literals: false},
+		{name: "literals", pattern: "error|warning|" + padding, literals: true},
+		{name: "alternation inside a group", pattern: "a(b|c|d)e|" + padding, literals: true},
+		{name: "pipe inside a class", pattern: "[|]x|" + padding, literals: true},
+		{name: "escaped pipe", pattern: `error\|warning|` + padding, literals: true},
+		{name: "case insensitive flag", pattern: "(?i)error|warning|" + padding, literals: false},
+		{name: "no literal", pattern: "err.r|w.rning|" + strings.Repeat("x.", patternSplitThreshold/2), literals: false},
+	}
+
+	lines := []string{"error", "ERROR", "warning", "WARNING", "ace", "c", "abe", "x|x", "|x", "error|warning", "errXr", padding}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			literals, regexes, err := compilePattern(tt.pattern)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.literals, literals != nil)
+
+			whole := regexp.MustCompile(tt.pattern)
+			for _, line := range lines {
+				matched := literals.Match([]byte(line))
+				for _, re := range regexes {
+					matched = matched || re.MatchString(line)
+				}
+				assert.Equal(t, whole.MatchString(line), matched, line)
+			}
+		})
+	}
+
+	_, _, err := compilePattern("(error|" + padding)
+	assert.Error(t, err)
+}
+
+func BenchmarkLongLiteralPattern(b *testing.B) {
+	pattern := longKeywordPattern(300)
+	lines := [][]byte{
+		[]byte(`2024-01-01T10:00:00Z INFO request served path=/api/users status=200 duration=12ms`),
+		[]byte(`2024-01-01T10:00:01Z WARN known-noise-250 occurred while refreshing the cache`),
+		[]byte(`2024-01-01T10:00:02Z ERROR upstream connection reset by peer`),
+	}
+
+	b.Run("split regexes", func(b *testing.B) {
+		regexes, err := splitAndCompilePattern(pattern)
+		if err != nil {
+			b.Fatal(err)
+		}
+		w := &Watcher{}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, line := range lines {
+				w.matchesAny(regexes, line)
+			}
+		}
+	})
+
+	b.Run("literals in one pass", func(b *testing.B) {
+		literals, regexes, err := compilePattern(pattern)
+		if err != nil {
+			b.Fatal(err)
+		}
+		w := &Watcher{}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, line := range lines {
+				_ = literals.Match(line) || w.matchesAny(regexes, line)
+			}
+		}
+	})
+}
+
 func BenchmarkLogRotation(b *testing.B) {
 	content := `line1
 error:1
@@ -725,7 +840,7 @@ line2`
 	}
 	defer watcher.Close()
 
-	result, err := watcher.Scan()
+	result, err := watcher.Scan(context.Background())
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -741,9 +856,342 @@ line2`
 	watcher.lastLineNum = 0
 
 	for i := 0; i < b.N; i++ {
-		_, err := watcher.Scan()
+		_, err := watcher.Scan(context.Background())
 		if err != nil {
 			b.Fatal(err)
 		}
 	}
 }
+
+func TestScanCancelledKeepsOffset(t *testing.T) {
+	content := strings.Repeat("error:1\n", ctxCheckLines*2)
+	filePath, err := setupTempFile(content)
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{Match: "error:1"}
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	watcher, err := NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = watcher.Scan(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// nothing was saved, the next scan reads the same lines
+	watcher, err = NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, ctxCheckLines*2, result.ErrorCount)
+}
+
+func TestScanNamedMatchCounts(t *testing.T) {
+	content := `OutOfMemory in worker
+Connection reset by peer
+OutOfMemory in worker, retrying
+Connection reset after OutOfMemory
+info: all good`
+	filePath, err := setupTempFile(content)
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{
+		Match:      "all good", // replaced by the named patterns
+		NamedMatch: "oom=OutOfMemory\ndb=Connection reset",
+		Ignore:     "retrying",
+	}
+
+	watcher, err := NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+	defer watcher.Close()
+
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.ErrorCount)
+	assert.Equal(t, map[string]int{"oom": 2, "db": 2}, result.MatchCounts)
+}
+
+func TestScanMultilineEvents(t *testing.T) {
+	content := `2024-01-01 10:00:00 ERROR request failed
+java.lang.IllegalStateException: boom
+	at com.example.Foo.bar(Foo.java:10)
+2024-01-01 10:00:01 INFO ok
+2024-01-01 10:00:02 ERROR request failed
+java.lang.IllegalStateException: again
+`
+	filePath, err := setupTempFile(content)
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{
+		Match:             "IllegalStateException",
+		MultilineStart:    `^\d{4}-\d{2}-\d{2} `,
+		MultilineMaxBytes: 1024,
+	}
+
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	watcher, err := NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+
+	// the last event may still grow, it is held back for the next scan
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	watcher.Close()
+	assert.Equal(t, 1, result.ErrorCount)
+	assert.Equal(t, 50.0, result.ErrorPercent)
+	assert.Equal(t, "2024-01-01 10:00:00 ERROR request failed\njava.lang.IllegalStateException: boom\n\tat com.example.Foo.bar(Foo.java:10)", result.FirstLine)
+	assert.Equal(t, "2024-01-01 10:00:00", result.FirstDate)
+
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = file.WriteString("\tat com.example.Foo.baz(Foo.java:20)\n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	var errorCounts []int
+	for i := 0; i < 2; i++ {
+		watcher, err = NewWatcher(filePath, f, c, nil)
+		assert.NoError(t, err)
+		result, err = watcher.Scan(context.Background())
+		assert.NoError(t, err)
+		watcher.Close()
+		errorCounts = append(errorCounts, result.ErrorCount)
+	}
+
+	// it grew by a line, then is complete once a scan finds nothing new
+	assert.Equal(t, []int{0, 1}, errorCounts)
+	assert.Equal(t, "2024-01-01 10:00:02 ERROR request failed\njava.lang.IllegalStateException: again\n\tat com.example.Foo.baz(Foo.java:20)", result.LastLine)
+	assert.Equal(t, 100.0, result.ErrorPercent)
+}
+
+func TestScanJSONWhere(t *testing.T) {
+	content := `{"time":"2024-01-01 10:00:00","level":"error","status":503,"msg":"upstream timeout"}
+{"status":200,"level":"info","msg":"ok","time":"2024-01-01 10:00:01"}
+{"level":"fatal","msg":"retrying upstream timeout","status":502,"time":"2024-01-01 10:00:02"}
+not json, level error
+{"level": "error", "status": 500, "msg": "db down", "time": "2024-01-01 10:00:03"}
+`
+	filePath, err := setupTempFile(content)
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{
+		Match:       ".*",
+		Format:      FormatJSON,
+		Where:       "level in [error,fatal] && status >= 500",
+		IgnoreWhere: `msg contains "retrying"`,
+		Fields:      "level,status,msg",
+	}
+
+	watcher, err := NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+	defer watcher.Close()
+
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.ErrorCount)
+	assert.Equal(t, `level=error status=503 msg="upstream timeout"`, result.FirstLine)
+	assert.Equal(t, `level=error status=500 msg="db down"`, result.LastLine)
+	assert.Equal(t, "2024-01-01 10:00:00", result.FirstDate)
+}
+
+func TestScanLTSVFieldCounts(t *testing.T) {
+	content := "status:503\turi:/api/users\treqtime:0.1\n" +
+		"status:200\turi:/api/users\treqtime:0.2\n" +
+		"status:502\turi:/api/orders\treqtime:2.5\n" +
+		"status:503\turi:/api/users\treqtime:3.1\n"
+	filePath, err := setupTempFile(content)
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{
+		Match:  ".*",
+		Format: FormatLTSV,
+		Where:  "status >= 500",
+		Fields: "status,uri",
+	}
+
+	watcher, err := NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+	defer watcher.Close()
+
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.ErrorCount)
+	assert.Equal(t, "status=503 uri=/api/users", result.FirstLine)
+	assert.Equal(t, map[string]map[string]int{
+		"status": {"503": 2, "502": 1},
+		"uri":    {"/api/users": 2, "/api/orders": 1},
+	}, result.FieldCounts)
+}
+
+func TestScanAccessThresholds(t *testing.T) {
+	line := func(status string, requestTime string) string {
+		return `client [01/Jan/2024:10:00:00 +0900] "GET /api HTTP/1.1" ` + status + " " + requestTime + "\n"
+	}
+	filePath, err := setupTempFile(line("200", "0.1") + line("200", "0.2") + line("503", "0.3") + line("200", "0.1"))
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{
+		Match:         ".*",
+		Format:        `$remote_addr [$time_local] "$request" $status $request_time`,
+		Where:         "status == 5xx",
+		StatusPercent: "5xx:10",
+		Latency:       "p95:1",
+		Streak:        1,
+	}
+
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	watcher, err := NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+	watcher.incrementScanCount()
+
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.ErrorCount)
+	assert.Equal(t, 4, result.Access.Requests)
+	assert.Equal(t, []string{"5xx 25.00% > 10%"}, result.Exceeded)
+	assert.Equal(t, []int{1}, result.Streak)
+
+	// a healthy scan does not count towards the streak even with a 5xx
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = file.WriteString(strings.Repeat(line("200", "0.1"), 20) + line("500", "0.1"))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	result, err = watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.ErrorCount)
+	assert.Empty(t, result.Exceeded)
+	assert.Equal(t, []int{1, 0}, result.Streak)
+}
+
+func TestScanWhereWithoutThresholds(t *testing.T) {
+	filePath, err := setupTempFile(`client "GET /api HTTP/1.1" 200` + "\n" + `client "GET /api HTTP/1.1" 503` + "\n")
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{Match: "GET", Format: `$remote_addr "$request" $status`, Where: "status == 5xx"}
+	watcher, err := NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+
+	// without --status-percent or --latency only the matching lines are parsed, no request stats
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.ErrorCount)
+	assert.Nil(t, result.Access)
+}
+
+func TestScanCaptureCounts(t *testing.T) {
+	content := `ERROR E500 GET /api/users
+ERROR E503 GET /api/orders
+INFO GET /api/users
+ERROR E500 GET /api/users
+ERROR timeout
+`
+	filePath, err := setupTempFile(content)
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{
+		Match: `ERROR (?P<code>E\d+) GET (?P<endpoint>/api/\S+)|ERROR timeout`,
+	}
+
+	watcher, err := NewWatcher(filePath, f, cache.New(cache.NoExpiration, cache.NoExpiration), nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+	defer watcher.Close()
+
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.ErrorCount)
+	assert.Equal(t, map[string]map[string]int{
+		"code":     {"E500": 2, "E503": 1},
+		"endpoint": {"/api/users": 2, "/api/orders": 1},
+	}, result.CaptureCounts)
+}
+
+func TestScanPercentAndRateThresholds(t *testing.T) {
+	filePath, err := setupTempFile(strings.Repeat("info\n", 8) + "error\nerror\n")
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{Match: "error", Min: 1, MinPercent: 15, Streak: 1}
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	watcher, err := NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 10, result.LinesRead)
+	assert.Equal(t, 20.0, result.ErrorPercent)
+	assert.Equal(t, []int{2}, result.Streak)
+
+	// 1 error in 10 new lines is under --min-percent, the scan does not count
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = file.WriteString(strings.Repeat("info\n", 9) + "error\n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	watcher, err = NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	result, err = watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 10, result.LinesRead)
+	assert.Equal(t, 10.0, result.ErrorPercent)
+	assert.Equal(t, 1, result.ErrorCount)
+	assert.Equal(t, []int{2, 0}, result.Streak)
+
+	// 3 errors over the 10 seconds since the previous scan are under --min-rate
+	file, err = os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = file.WriteString("error\nerror\nerror\n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	f = Flags{Match: "error", Min: 1, MinRate: 1, Streak: 1}
+	watcher, err = NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	watcher.lastScanAt = time.Now().Add(-10 * time.Second)
+	result, err = watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.3, result.ErrorRate, 0.01)
+	assert.Equal(t, []int{2, 0, 0}, result.Streak)
+}
+
+func TestScanMaxAgeSkipsStaleLines(t *testing.T) {
+	recent := time.Now().Format("2006-01-02 15:04:05")
+	content := "2020-01-02 03:04:05 error from the backup\n" +
+		recent + " error just now\n" +
+		"error without a timestamp\n"
+	filePath, err := setupTempFile(content)
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	f := Flags{Match: "error", MaxAgeSecs: 300, Streak: 1}
+	c := cache.New(cache.NoExpiration, cache.NoExpiration)
+	watcher, err := NewWatcher(filePath, f, c, nil)
+	assert.NoError(t, err)
+	watcher.incrementScanCount()
+
+	result, err := watcher.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.LinesRead)
+	assert.Equal(t, 2, result.ErrorCount)
+	assert.Equal(t, 1, result.StaleCount)
+	assert.Equal(t, recent+" error just now", result.FirstLine)
+	assert.Equal(t, []int{2}, result.Streak)
+}